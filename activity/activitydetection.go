@@ -4,9 +4,12 @@ import (
 	"github.com/knadh/koanf/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
+	"math"
 	prp "nudge/internal/database/pr"
 	"nudge/internal/database/repository"
 	time2 "nudge/internal/time"
+	"nudge/repoconfig"
+	"strings"
 	"time"
 )
 
@@ -26,15 +29,47 @@ func Init(ko *koanf.Koanf, db *mongo.Database, lo *log.Logger) *Activity {
 
 type ActivityDetection struct {
 	Detected bool
+	// Score is the weighted sum of the activity signals observed within the interval to wait
+	Score float64
+	// CIPending is true if the PR is blocked on the checks which are still running
+	CIPending bool
+}
+
+const (
+	actorAuthor   = "author"
+	actorReviewer = "reviewer"
+	actorOther    = "other"
+	actorBot      = "bot"
+)
+
+// defaultSignalWeights are used for the signals without a bot.activity.signal_weights.* configuration
+var defaultSignalWeights = map[string]float64{
+	prp.SignalCommit:          1,
+	prp.SignalReview:          1,
+	prp.SignalStateChange:     1,
+	prp.SignalThreadStatus:    0.75,
+	prp.SignalComment:         0.5,
+	prp.SignalAcknowledgement: 1,
+}
+
+// defaultActorWeights are used for the actors without a bot.activity.actor_weights.* configuration
+var defaultActorWeights = map[string]float64{
+	actorAuthor:   1,
+	actorReviewer: 1,
+	actorOther:    0.5,
+	actorBot:      0.1,
 }
 
 type DelayedPRDetails struct {
 	Repository repository.RepoModel
 	DelayedPR  prp.PRModel
+	// Config is the configuration for the repository, with the settings of its configuration file
+	Config *koanf.Koanf
 }
 
 type delayedPRChanDetails struct {
 	Repository    repository.RepoModel
+	Config        *koanf.Koanf
 	DelayedPRList chan []prp.PRModel
 }
 
@@ -61,9 +96,11 @@ func (activity *Activity) ActivityCheckTrigger() (*[]DelayedPRDetails, error) {
 
 	delayedPRChanList := make([]delayedPRChanDetails, 0)
 	for _, repo := range *repoList {
+		repoActivity := activity.forRepository(repo)
 		delayedPRChanList = append(delayedPRChanList, delayedPRChanDetails{
 			Repository:    repo,
-			DelayedPRList: activity.FindDelayedPRs(repo), // Loads PR using simultaneous coroutines
+			Config:        repoActivity.ko,
+			DelayedPRList: repoActivity.FindDelayedPRs(repo), // Loads PR using simultaneous coroutines
 		})
 	}
 
@@ -73,6 +110,7 @@ func (activity *Activity) ActivityCheckTrigger() (*[]DelayedPRDetails, error) {
 			delayedPrs = append(delayedPrs, DelayedPRDetails{
 				Repository: prs.Repository,
 				DelayedPR:  pr,
+				Config:     prs.Config,
 			})
 		}
 	}
@@ -80,6 +118,15 @@ func (activity *Activity) ActivityCheckTrigger() (*[]DelayedPRDetails, error) {
 	return &delayedPrs, nil
 }
 
+// forRepository returns the activity detection using the configuration for the repository
+func (activity *Activity) forRepository(repo repository.RepoModel) *Activity {
+	return &Activity{
+		ko: repoconfig.ForRepository(activity.ko, repo.Config),
+		db: activity.db,
+		lo: activity.lo,
+	}
+}
+
 func (activity *Activity) FindDelayedPRs(repo repository.RepoModel) chan []prp.PRModel {
 	delayedPRs := make(chan []prp.PRModel)
 	go func() {
@@ -95,6 +142,18 @@ func (activity *Activity) FindDelayedPRs(repo repository.RepoModel) chan []prp.P
 				// Skip draft PRs
 				continue
 			}
+			if activity.isExcluded(openPR) {
+				// Skip the PRs excluded by the configuration of the repository
+				continue
+			}
+			if openPR.NudgeDisabled != nil && *openPR.NudgeDisabled {
+				// Skip the PRs whose nudges have been stopped (/nudge stop)
+				continue
+			}
+			if isSnoozed(openPR, time.Now()) {
+				// Skip the PRs snoozed until later
+				continue
+			}
 			moving := activity.IsPRMoving(openPR, activity)
 			if !*moving {
 				prList = append(prList, openPR)
@@ -106,6 +165,41 @@ func (activity *Activity) FindDelayedPRs(repo repository.RepoModel) chan []prp.P
 	return delayedPRs
 }
 
+// isExcluded returns true if the author (bot.exclude.authors), any label (bot.exclude.labels) or the title
+// prefix (bot.exclude.title_prefixes) of the PR is excluded from the nudges
+func (activity *Activity) isExcluded(prModel prp.PRModel) bool {
+	if prModel.Author != nil {
+		for _, author := range activity.ko.Strings("bot.exclude.authors") {
+			if strings.EqualFold(author, *prModel.Author) {
+				return true
+			}
+		}
+	}
+	if prModel.Labels != nil {
+		for _, excluded := range activity.ko.Strings("bot.exclude.labels") {
+			for _, label := range *prModel.Labels {
+				if strings.EqualFold(excluded, label) {
+					return true
+				}
+			}
+		}
+	}
+	if prModel.Title != nil {
+		title := strings.ToLower(strings.TrimSpace(*prModel.Title))
+		for _, prefix := range activity.ko.Strings("bot.exclude.title_prefixes") {
+			if strings.HasPrefix(title, strings.ToLower(prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSnoozed returns true if the nudges of the PR are snoozed at the time
+func isSnoozed(prModel prp.PRModel, now time.Time) bool {
+	return prModel.SnoozedUntil != nil && *prModel.SnoozedUntil > now.Unix()
+}
+
 // CheckForActivity Once a pull request’s actual lifetime crosses the estimated lifetime
 // (using the effort estimation models), the next module, Activity Detection, is run,
 // which checks for any activity in the pull request environment. If there is an activity
@@ -150,16 +244,29 @@ func (activity *Activity) CheckForActivity(prModel prp.PRModel) *ActivityDetecti
 	*/
 	nt := new(time2.NudgeTime)
 	now := nt.Now()
+	if activity.isCIPending(prModel, *now) {
+		// The PR is blocked on the CI, not on any of the actors
+		activityDetection.Detected = true
+		activityDetection.CIPending = true
+		return activityDetection
+	}
+
+	if prModel.ActivitySignals != nil && len(*prModel.ActivitySignals) > 0 {
+		// Every signal observed within the interval to wait adds to the score, weighted by
+		// the kind of signal and the role of the actor. The activity is detected only once
+		// the score reaches the threshold.
+		activityDetection.Score = activity.activityScore(prModel, *now)
+		activityDetection.Detected = activityDetection.Score >= activity.activityThreshold()
+		return activityDetection
+	}
+
+	// PRs without any recorded signal fall back on the last workflow activity
 	workflowLastUpdated := now.AddDate(-100, 0, 0)
 	// the default is set 100 years back
 	if prModel.WorkflowLastActivity != nil {
 		workflowLastUpdated = time.Unix(*prModel.WorkflowLastActivity, 0)
 	}
-	timeSinceLastActivity := now.Sub(workflowLastUpdated).Hours()
-	if activity.ko.String("bot.interval_to_wait.unit") == "m" {
-		timeSinceLastActivity = now.Sub(workflowLastUpdated).Minutes()
-	}
-	if timeSinceLastActivity < activity.ko.Float64("bot.interval_to_wait.time") {
+	if activity.elapsedInterval(*now, workflowLastUpdated) < activity.ko.Float64("bot.interval_to_wait.time") {
 		// Nothing more to be done!
 		activityDetection.Detected = true
 	} else {
@@ -174,6 +281,89 @@ func (activity *Activity) CheckForActivity(prModel prp.PRModel) *ActivityDetecti
 	return activityDetection
 }
 
+// activityScore sums the weights of the signals of the PR which occurred within the interval to wait
+func (activity *Activity) activityScore(prModel prp.PRModel, now time.Time) float64 {
+	botUsername := activity.ko.String("github.bot_username")
+	score := 0.0
+	for _, signal := range *prModel.ActivitySignals {
+		if len(botUsername) > 0 && strings.EqualFold(signal.Actor, botUsername) {
+			// The nudges never count as an activity
+			continue
+		}
+		if activity.elapsedInterval(now, time.Unix(signal.OccurredAt, 0)) >= activity.ko.Float64("bot.interval_to_wait.time") {
+			continue
+		}
+		signalWeight := activity.weight("bot.activity.signal_weights."+signal.Signal, defaultSignalWeights[signal.Signal])
+		if signal.Signal == prp.SignalAcknowledgement {
+			// Only the nudged actors (e.g. the members of a requested team or the code owners) can acknowledge the
+			// nudge, so the acknowledgement is not weighted by the actor and is always an activity on its own
+			score += math.Max(signalWeight, activity.activityThreshold())
+			continue
+		}
+		score += signalWeight *
+			activity.weight("bot.activity.actor_weights."+actorRole(prModel, signal), defaultActorWeights[actorRole(prModel, signal)])
+	}
+	return score
+}
+
+// isCIPending returns true if the checks of the PR are still running. Once the checks have been
+// running for longer than bot.ci.pending_timeout, they are considered stuck and no longer hold
+// back the nudges.
+func (activity *Activity) isCIPending(prModel prp.PRModel, now time.Time) bool {
+	if prModel.CIState == nil || *prModel.CIState != prp.CIStatePending {
+		return false
+	}
+	timeout := activity.ko.Float64("bot.ci.pending_timeout")
+	if timeout <= 0 || prModel.CIPendingSince == nil {
+		return true
+	}
+	return activity.elapsedInterval(now, time.Unix(*prModel.CIPendingSince, 0)) < timeout
+}
+
+// elapsedInterval returns the time elapsed since the given time, in the unit of bot.interval_to_wait
+func (activity *Activity) elapsedInterval(now time.Time, since time.Time) float64 {
+	if activity.ko.String("bot.interval_to_wait.unit") == "m" {
+		return now.Sub(since).Minutes()
+	}
+	return now.Sub(since).Hours()
+}
+
+func (activity *Activity) activityThreshold() float64 {
+	return activity.weight("bot.activity.threshold", 1)
+}
+
+func (activity *Activity) weight(key string, defaultWeight float64) float64 {
+	if activity.ko.Exists(key) {
+		return activity.ko.Float64(key)
+	}
+	return defaultWeight
+}
+
+// actorRole returns the role of the actor of the signal in the PR
+func actorRole(prModel prp.PRModel, signal prp.ActivitySignal) string {
+	if signal.IsBot {
+		return actorBot
+	}
+	if prModel.Author != nil && strings.EqualFold(*prModel.Author, signal.Actor) {
+		return actorAuthor
+	}
+	if prModel.RequestedReviewers != nil {
+		for _, reviewer := range *prModel.RequestedReviewers {
+			if strings.EqualFold(reviewer, signal.Actor) {
+				return actorReviewer
+			}
+		}
+	}
+	if prModel.Reviews != nil {
+		for _, review := range *prModel.Reviews {
+			if review.Reviewer != nil && strings.EqualFold(*review.Reviewer, signal.Actor) {
+				return actorReviewer
+			}
+		}
+	}
+	return actorOther
+}
+
 // IsPRMoving checks if there has been some activity in the PR. Returns true
 // if the hours elapsed since PR creation is less than the predicted lifetime.
 func (activity *Activity) IsPRMoving(openPR prp.PRModel, checkForActivityI CheckForActivityInterface) *bool {
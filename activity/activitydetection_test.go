@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"log"
 	prp "nudge/internal/database/pr"
+	"nudge/internal/database/repository"
 	"os"
 	"testing"
 	"time"
@@ -114,6 +115,173 @@ func TestCheckForActivity(t *testing.T) {
 	}
 }
 
+func TestCheckForActivitySignals(t *testing.T) {
+	logger := log.New(os.Stdout, "test: ", log.Lshortfile)
+	author := "author"
+	reviewer := "reviewer"
+	recently := time.Now().Add(-30 * time.Minute).Unix()
+	longAgo := time.Now().Add(-25 * time.Hour).Unix()
+
+	testCases := []struct {
+		Name                   string
+		Signals                []prp.ActivitySignal
+		Config                 map[string]interface{}
+		ExpectedActivityResult bool
+		ExpectedScore          float64
+	}{
+		{
+			Name:                   "Commit by the author",
+			Signals:                []prp.ActivitySignal{{Signal: prp.SignalCommit, Actor: author, OccurredAt: recently}},
+			ExpectedActivityResult: true,
+			ExpectedScore:          1,
+		},
+		{
+			Name:                   "Comment by someone else",
+			Signals:                []prp.ActivitySignal{{Signal: prp.SignalComment, Actor: "someone", OccurredAt: recently}},
+			ExpectedActivityResult: false,
+			ExpectedScore:          0.25,
+		},
+		{
+			Name: "Comments by the author and the reviewer",
+			Signals: []prp.ActivitySignal{
+				{Signal: prp.SignalComment, Actor: author, OccurredAt: recently},
+				{Signal: prp.SignalComment, Actor: reviewer, OccurredAt: recently},
+			},
+			ExpectedActivityResult: true,
+			ExpectedScore:          1,
+		},
+		{
+			Name:                   "Comment by a bot",
+			Signals:                []prp.ActivitySignal{{Signal: prp.SignalComment, Actor: "ci[bot]", IsBot: true, OccurredAt: recently}},
+			ExpectedActivityResult: false,
+			ExpectedScore:          0.05,
+		},
+		{
+			Name: "Nudges never count",
+			Signals: []prp.ActivitySignal{
+				{Signal: prp.SignalComment, Actor: "nudge[bot]", IsBot: true, OccurredAt: recently},
+				{Signal: prp.SignalComment, Actor: "Nudge[bot]", IsBot: true, OccurredAt: recently},
+			},
+			Config: map[string]interface{}{
+				"bot.activity.actor_weights.bot": 1.0,
+			},
+			ExpectedActivityResult: false,
+			ExpectedScore:          0,
+		},
+		{
+			Name:                   "Acknowledgement by a member of the requested team",
+			Signals:                []prp.ActivitySignal{{Signal: prp.SignalAcknowledgement, Actor: "team-member", OccurredAt: recently}},
+			ExpectedActivityResult: true,
+			ExpectedScore:          1,
+		},
+		{
+			Name:    "Acknowledgement meets a configured threshold",
+			Signals: []prp.ActivitySignal{{Signal: prp.SignalAcknowledgement, Actor: "code-owner", OccurredAt: recently}},
+			Config: map[string]interface{}{
+				"bot.activity.threshold": 2.0,
+			},
+			ExpectedActivityResult: true,
+			ExpectedScore:          2,
+		},
+		{
+			Name:                   "Signals outside the interval to wait",
+			Signals:                []prp.ActivitySignal{{Signal: prp.SignalCommit, Actor: author, OccurredAt: longAgo}},
+			ExpectedActivityResult: false,
+			ExpectedScore:          0,
+		},
+		{
+			Name:    "Configured weights and threshold",
+			Signals: []prp.ActivitySignal{{Signal: prp.SignalThreadStatus, Actor: reviewer, OccurredAt: recently}},
+			Config: map[string]interface{}{
+				"bot.activity.signal_weights.thread_status": 0.4,
+				"bot.activity.threshold":                    0.5,
+			},
+			ExpectedActivityResult: false,
+			ExpectedScore:          0.4,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			k := koanf.New(".")
+			k.Load(confmap.Provider(map[string]interface{}{
+				"bot.interval_to_wait.unit": "h",
+				"bot.interval_to_wait.time": 24.0,
+				"github.bot_username":       "nudge[bot]",
+			}, "."), nil)
+			k.Load(confmap.Provider(testCase.Config, "."), nil)
+
+			activity := &Activity{
+				ko: k,
+				lo: logger,
+			}
+			signals := testCase.Signals
+			result := activity.CheckForActivity(prp.PRModel{
+				Author:             &author,
+				RequestedReviewers: &[]string{reviewer},
+				// The signals take precedence over the last workflow activity
+				WorkflowLastActivity: int64Ptr(time.Now().Unix()),
+				ActivitySignals:      &signals,
+			})
+
+			assert.Equal(t, testCase.ExpectedActivityResult, result.Detected)
+			assert.InDelta(t, testCase.ExpectedScore, result.Score, 0.0001)
+		})
+	}
+}
+
+func TestCheckForActivityCIPending(t *testing.T) {
+	logger := log.New(os.Stdout, "test: ", log.Lshortfile)
+	pending := prp.CIStatePending
+	failure := prp.CIStateFailure
+
+	testCases := []struct {
+		Name                   string
+		PRModel                prp.PRModel
+		ExpectedActivityResult bool
+		ExpectedCIPending      bool
+	}{
+		{
+			Name:                   "Checks running",
+			PRModel:                prp.PRModel{CIState: &pending, CIPendingSince: int64Ptr(time.Now().Add(-2 * time.Hour).Unix())},
+			ExpectedActivityResult: true,
+			ExpectedCIPending:      true,
+		},
+		{
+			Name:                   "Checks running past the timeout",
+			PRModel:                prp.PRModel{CIState: &pending, CIPendingSince: int64Ptr(time.Now().Add(-7 * time.Hour).Unix())},
+			ExpectedActivityResult: false,
+			ExpectedCIPending:      false,
+		},
+		{
+			Name:                   "Checks failing",
+			PRModel:                prp.PRModel{CIState: &failure},
+			ExpectedActivityResult: false,
+			ExpectedCIPending:      false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			k := koanf.New(".")
+			k.Load(confmap.Provider(map[string]interface{}{
+				"bot.interval_to_wait.unit": "h",
+				"bot.interval_to_wait.time": 1.0,
+				"bot.ci.pending_timeout":    6.0,
+			}, "."), nil)
+
+			activity := &Activity{
+				ko: k,
+				lo: logger,
+			}
+			result := activity.CheckForActivity(testCase.PRModel)
+
+			assert.Equal(t, testCase.ExpectedActivityResult, result.Detected)
+			assert.Equal(t, testCase.ExpectedCIPending, result.CIPending)
+		})
+	}
+}
+
 type CheckForActivityMock struct {
 	mock.Mock
 }
@@ -189,3 +357,44 @@ func TestIsPRMoving(t *testing.T) {
 func int64Ptr(i int64) *int64 {
 	return &i
 }
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestIsExcluded(t *testing.T) {
+	lo := log.New(os.Stdout, "", log.LstdFlags)
+	global := koanf.New(".")
+	global.Load(confmap.Provider(map[string]interface{}{
+		"bot.exclude.authors":        []interface{}{"dependabot[bot]"},
+		"bot.exclude.title_prefixes": []interface{}{"WIP:"},
+	}, "."), nil)
+	config := "exclude:\n  labels: [WIP]\n"
+	activity := Init(global, nil, lo).forRepository(repository.RepoModel{Config: &config})
+
+	testCases := []struct {
+		Name     string
+		PRModel  prp.PRModel
+		Excluded bool
+	}{
+		{"Not excluded", prp.PRModel{Author: strPtr("octocat"), Labels: &[]string{"backend"}}, false},
+		{"Excluded author", prp.PRModel{Author: strPtr("Dependabot[bot]")}, true},
+		{"Excluded label", prp.PRModel{Author: strPtr("octocat"), Labels: &[]string{"backend", "wip"}}, true},
+		{"Excluded title prefix", prp.PRModel{Author: strPtr("octocat"), Title: strPtr(" wip: Add the snooze labels")}, true},
+		{"Title prefix elsewhere", prp.PRModel{Author: strPtr("octocat"), Title: strPtr("Support WIP: titles")}, false},
+		{"Without author and labels", prp.PRModel{}, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert.Equal(t, testCase.Excluded, activity.isExcluded(testCase.PRModel))
+		})
+	}
+}
+
+func TestIsSnoozed(t *testing.T) {
+	now := time.Now()
+	assert.False(t, isSnoozed(prp.PRModel{}, now))
+	assert.True(t, isSnoozed(prp.PRModel{SnoozedUntil: int64Ptr(now.Add(time.Hour).Unix())}, now))
+	assert.False(t, isSnoozed(prp.PRModel{SnoozedUntil: int64Ptr(now.Add(-time.Hour).Unix())}, now))
+}
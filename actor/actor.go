@@ -8,13 +8,55 @@ import (
 	"nudge/internal/database/repository"
 	provider "nudge/internal/provider/github"
 	"sort"
+	"strings"
 )
 
 type GithubUserName string
 
+// ReasonCode identifies why the actor is blocking the PR
+type ReasonCode string
+
+const (
+	// ReasonAwaitingFirstReview the reviewer is yet to review the PR
+	ReasonAwaitingFirstReview ReasonCode = "awaiting_first_review"
+	// ReasonChangesRequested the reviewers requested changes which the author is yet to make
+	ReasonChangesRequested ReasonCode = "changes_requested"
+	// ReasonUnresolvedThreads the review comments are yet to be resolved by the author
+	ReasonUnresolvedThreads ReasonCode = "unresolved_threads"
+	// ReasonApprovedNotMerged the PR is approved and the author just needs to merge it
+	ReasonApprovedNotMerged ReasonCode = "approved_not_merged"
+	// ReasonCIFailing the checks of the head commit of the PR are failing
+	ReasonCIFailing ReasonCode = "ci_failing"
+	// ReasonMergeConflict the PR has conflicts with its base branch
+	ReasonMergeConflict ReasonCode = "merge_conflict"
+	// ReasonBehindBase the PR is behind its protected base branch, which requires it to be up-to-date
+	ReasonBehindBase ReasonCode = "behind_base"
+	// ReasonNotEnoughApprovals the PR has fewer approvals than required by the base branch
+	ReasonNotEnoughApprovals ReasonCode = "not_enough_approvals"
+)
+
+// BlockingReason is the reason because of which the actor is blocking the PR, along with the
+// details supporting it
+type BlockingReason struct {
+	Code ReasonCode
+	// ChangesRequestedBy are the reviewers whose latest review requested changes
+	ChangesRequestedBy []GithubUserName
+	// UnresolvedThreads is the number of review threads, started by the reviewers who are yet to approve,
+	// which are yet to be resolved
+	UnresolvedThreads int
+	// ApprovalsRequired is the number of approvals required by the base branch
+	ApprovalsRequired int
+	// MissingApprovals is the number of approvals still required to merge the PR
+	MissingApprovals int
+}
+
 type ActorDetails struct {
-	IsReviewer     bool
+	IsReviewer bool
+	// IsTeam is true if the actor is a team requested to review the PR. The
+	// GithubUserName of a team is its handle (org/team).
+	IsTeam         bool
 	GithubUserName GithubUserName
+	Reason         BlockingReason
 }
 
 type ActorIdentifier interface {
@@ -33,76 +75,152 @@ func (actor *Actor) IdentifyActors(delayedPR prp.PRModel, repo repository.RepoMo
 	// Reference: https://docs.github.com/en/rest/pulls/review-requests?apiVersion=2022-11-28#get-all-requested-reviewers-for-a-pull-request
 
 	// If there are no reviewers, blocker could either be a reviewer or the author
-	jwt, _ := provider.GenerateAppJWT(ko.String("app.private_key"), ko.String("github.app_id"))
-	g := provider.Init(*jwt)
-	iToken, appTokenErr := g.GetAppInstallationAccessToken(repo.InstallationId)
+	g, appTokenErr := provider.AppTokens(ko.String("app.private_key"), ko.String("github.app_id")).Client(repo.InstallationId)
 	if appTokenErr != nil {
 		return nil, appTokenErr
 	}
-
-	g = provider.Init(*iToken.Token)
 	prDetails, prErr := g.GetPrById(delayedPR.Number, repo.Owner, repo.Name)
 	if prErr != nil {
 		return nil, prErr
 	}
 
+	if isCIFailing(delayedPR, prDetails) {
+		// A PR with failing checks is blocked on the author, even if the reviewers
+		// are yet to review it
+		return []ActorDetails{{
+			IsReviewer:     false,
+			GithubUserName: GithubUserName(*prDetails.User.Login),
+			Reason:         BlockingReason{Code: ReasonCIFailing},
+		}}, nil
+	}
+
+	// The requirements come from the classic branch protection and the rulesets of the base branch
 	baseBranch := prDetails.Base.Ref
-	protectionRules, protectionErr := g.GetBranchProtection(repo.Name, *baseBranch, repo.Owner)
-	if protectionErr != nil {
-		if !errors.Is(protectionErr, github.ErrBranchNotProtected) {
-			return nil, protectionErr
-		}
-		// If the branch is not protected, move ahead
+	requirements, requirementsErr := FetchReviewRequirements(g, repo.Owner, repo.Name, *baseBranch)
+	if requirementsErr != nil {
+		return nil, requirementsErr
 	}
 
-	minReviewsRequired := 0
-	if protectionRules != nil && protectionRules.RequiredPullRequestReviews != nil {
-		minReviewsRequired = protectionRules.RequiredPullRequestReviews.RequiredApprovingReviewCount
+	minReviewsRequired := requirements.RequiredApprovingReviewCount
+
+	// A reviewer requested to review the PR again (e.g. once the author pushed the changes) is blocking it,
+	// whatever their previous reviews were, so their previous reviews and threads are set aside
+	reRequested := reRequestedReviewers(delayedPR.Reviews, delayedPR.ReviewRequests)
+	reviews := currentReviews(delayedPR.Reviews, reRequested)
+	threads := currentThreads(delayedPR.ReviewThreads, reRequested)
+
+	approvals := approvalsReason(reviews, minReviewsRequired)
+	awaitingReview := BlockingReason{Code: ReasonAwaitingFirstReview, ApprovalsRequired: minReviewsRequired, MissingApprovals: approvals.MissingApprovals}
+
+	// The code owners of the changed files implicitly need to review the PR, even
+	// if they have not been requested to
+	codeOwners := make([]string, 0)
+	if requirements.RequireCodeOwnerReviews {
+		owners, ownersErr := pendingCodeOwners(g, repo, prDetails, reviews)
+		if ownersErr != nil {
+			return nil, ownersErr
+		}
+		codeOwners = owners
 	}
 
-	prReviewed := isPrReviewed(minReviewsRequired, prDetails)
+	prReviewed := isPrReviewed(minReviewsRequired, prDetails) && len(codeOwners) == 0
 	if !prReviewed {
 		actors := make([]ActorDetails, 0)
+		requested := make(map[GithubUserName]bool)
 		for _, r := range prDetails.RequestedReviewers {
 			login := GithubUserName(*r.Login)
+			reason := approvals
+			if !hasReviewed(delayedPR.Reviews, login) {
+				reason = awaitingReview
+			}
+			requested[login] = true
+			actors = append(actors, ActorDetails{
+				IsReviewer:     true,
+				GithubUserName: login,
+				Reason:         reason,
+			})
+		}
+		for _, t := range prDetails.RequestedTeams {
+			if t.Slug == nil {
+				continue
+			}
+			handle := GithubUserName(prp.TeamHandle(repo.Owner, t))
+			requested[handle] = true
+			actors = append(actors, ActorDetails{
+				IsReviewer:     true,
+				IsTeam:         true,
+				GithubUserName: handle,
+				Reason:         awaitingReview,
+			})
+		}
+		for _, owner := range codeOwners {
+			login := GithubUserName(owner)
+			if requested[login] {
+				continue
+			}
+			reason := approvals
+			if !hasReviewed(delayedPR.Reviews, login) {
+				reason = awaitingReview
+			}
 			actors = append(actors, ActorDetails{
 				IsReviewer:     true,
+				IsTeam:         strings.Contains(owner, "/"),
 				GithubUserName: login,
+				Reason:         reason,
 			})
 		}
 		// Return the list of reviewers because of which the PR is blocked
+		sortActors(actors)
 		return actors, nil
 	}
 
-	prApproved, userReviewMap := isPrApproved(delayedPR.Reviews, minReviewsRequired)
+	prApproved, userReviewMap := isPrApproved(reviews, minReviewsRequired)
+	// The PR is not approved until the re-requested reviewers review it again
+	prApproved = prApproved && len(reRequested) == 0
 
 	if prReviewed && prApproved {
-		// return the author who now just needs to merge
+		// return the author who now just needs to merge, or to resolve the conflicts
+		// (or rebase) before the PR can be merged
+		reason := BlockingReason{Code: ReasonApprovedNotMerged}
+		if code := mergeBlockingReason(prDetails, *requirements); code != "" {
+			reason.Code = code
+		}
 		return []ActorDetails{{
 			IsReviewer:     false,
 			GithubUserName: GithubUserName(*prDetails.User.Login),
+			Reason:         reason,
 		}}, nil
 	}
 
-	pendingAuthorActItems := hasPendingActionItemsForAuthor(delayedPR.Reviews)
+	author := GithubUserName(*prDetails.User.Login)
+	pendingAuthorActItems := hasPendingActionItemsForAuthor(reviews, threads, author)
 	if pendingAuthorActItems {
 		// return author who might need to discuss with reviewer
-		return []ActorDetails{{IsReviewer: false, GithubUserName: GithubUserName(*prDetails.User.Login)}}, nil
+		return []ActorDetails{{
+			IsReviewer:     false,
+			GithubUserName: author,
+			Reason:         authorActionItemsReason(reviews, threads, author),
+		}}, nil
 	} else {
 		// return the reviewers
 		actors := make([]ActorDetails, 0)
-		for username, v := range userReviewMap {
-			foundApproval := false
-			for _, review := range v {
-				if *review.ReviewState == "approved" {
-					foundApproval = true
-					break
-				}
-			}
-			if !foundApproval {
+		states := latestReviewStates(reviews)
+		for username := range userReviewMap {
+			// The reviewers whose approval was dismissed need to approve again
+			if states[username] != "approved" {
 				actors = append(actors, ActorDetails{
 					IsReviewer:     true,
 					GithubUserName: username,
+					Reason:         approvals,
+				})
+			}
+		}
+		for reviewer := range reRequested {
+			if _, found := userReviewMap[reviewer]; !found {
+				actors = append(actors, ActorDetails{
+					IsReviewer:     true,
+					GithubUserName: reviewer,
+					Reason:         approvals,
 				})
 			}
 		}
@@ -115,13 +233,276 @@ func (actor *Actor) IdentifyActors(delayedPR prp.PRModel, repo repository.RepoMo
 			actors = append(actors, ActorDetails{
 				IsReviewer:     false,
 				GithubUserName: GithubUserName(*prDetails.User.Login),
+				Reason:         approvals,
 			})
 		}
+		sortActors(actors)
 		return actors, nil
 	}
 
 }
 
+// pendingCodeOwners returns the code owners of the files changed by the PR who are yet to approve it.
+// The CODEOWNERS file is read from the base branch of the PR.
+func pendingCodeOwners(g *provider.GitHub, repo repository.RepoModel, prDetails *github.PullRequest, reviews *[]prp.Review) ([]string, error) {
+	content, err := g.GetCodeOwners(repo.Owner, repo.Name, prDetails.GetBase().GetRef())
+	if err != nil {
+		if errors.Is(err, provider.ErrCodeOwnersNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files, filesErr := g.GetPRFiles(repo.Owner, repo.Name, prDetails.GetNumber())
+	if filesErr != nil {
+		return nil, filesErr
+	}
+
+	owners := CodeOwnersOfFiles(ParseCodeOwners(content), files)
+	teamMembers := make(map[string][]string)
+	for _, owner := range owners {
+		org, slug, isTeam := strings.Cut(owner, "/")
+		if !isTeam {
+			continue
+		}
+		members, membersErr := g.GetTeamMembers(org, slug)
+		if membersErr != nil {
+			return nil, membersErr
+		}
+		logins := make([]string, 0)
+		for _, m := range members {
+			logins = append(logins, m.GetLogin())
+		}
+		teamMembers[owner] = logins
+	}
+
+	return filterPendingCodeOwners(owners, prDetails.GetUser().GetLogin(), reviews, teamMembers), nil
+}
+
+// filterPendingCodeOwners returns the owners who are yet to approve the PR. A team is pending until
+// one of its members (teamMembers) approves the PR. The author cannot approve their own PR, so they
+// are never pending.
+func filterPendingCodeOwners(owners []string, author string, reviews *[]prp.Review, teamMembers map[string][]string) []string {
+	approvedBy := make(map[string]bool)
+	for reviewer, state := range latestReviewStates(reviews) {
+		if state == "approved" {
+			approvedBy[strings.ToLower(string(reviewer))] = true
+		}
+	}
+
+	pending := make([]string, 0)
+	for _, owner := range owners {
+		if strings.EqualFold(owner, author) {
+			continue
+		}
+		approved := approvedBy[strings.ToLower(owner)]
+		for _, member := range teamMembers[owner] {
+			if !strings.EqualFold(member, author) && approvedBy[strings.ToLower(member)] {
+				approved = true
+				break
+			}
+		}
+		if !approved {
+			pending = append(pending, owner)
+		}
+	}
+	return pending
+}
+
+// sortActors orders the actors by their GitHub username, so that the actors are
+// notified in the same order on every run
+func sortActors(actors []ActorDetails) {
+	sort.SliceStable(actors, func(i, j int) bool {
+		return actors[i].GithubUserName < actors[j].GithubUserName
+	})
+}
+
+// isCIFailing returns true if the checks of the current head commit of the PR are failing. The
+// CI state recorded for an older head commit is ignored.
+func isCIFailing(delayedPR prp.PRModel, prDetails *github.PullRequest) bool {
+	if delayedPR.CIState == nil || *delayedPR.CIState != prp.CIStateFailure {
+		return false
+	}
+	return delayedPR.HeadSHA != nil && *delayedPR.HeadSHA == prDetails.GetHead().GetSHA()
+}
+
+// mergeBlockingReason returns the reason because of which the PR cannot be merged by its author, or an
+// empty reason if the PR is mergeable. GitHub computes the mergeability in the background, a PR whose
+// mergeability is not known yet is considered mergeable.
+// Reference: https://docs.github.com/en/rest/guides/using-the-rest-api-to-interact-with-your-git-database?apiVersion=2022-11-28#checking-mergeability-of-pull-requests
+func mergeBlockingReason(prDetails *github.PullRequest, requirements ReviewRequirements) ReasonCode {
+	if (prDetails.Mergeable != nil && !*prDetails.Mergeable) || prDetails.GetMergeableState() == "dirty" {
+		return ReasonMergeConflict
+	}
+	if prDetails.GetMergeableState() == "behind" && requirements.Protected {
+		return ReasonBehindBase
+	}
+	return ""
+}
+
+// latestReviewStates returns the state of the latest review of every reviewer which either approved
+// or requested changes, or was dismissed. The reviews which only commented do not change the state of the
+// reviewer, while a dismissed review leaves the reviewer neither approving nor requesting changes.
+func latestReviewStates(reviews *[]prp.Review) map[GithubUserName]string {
+	states := make(map[GithubUserName]string)
+	if reviews == nil {
+		return states
+	}
+	submittedAt := make(map[GithubUserName]int64)
+	for _, review := range *reviews {
+		if review.Reviewer == nil || review.ReviewState == nil {
+			continue
+		}
+		if *review.ReviewState != "approved" && *review.ReviewState != "changes_requested" && *review.ReviewState != prp.ReviewStateDismissed {
+			continue
+		}
+		reviewer := GithubUserName(*review.Reviewer)
+		var at int64
+		if review.SubmittedAt != nil {
+			at = *review.SubmittedAt
+		}
+		if _, exists := states[reviewer]; !exists || at >= submittedAt[reviewer] {
+			states[reviewer] = *review.ReviewState
+			submittedAt[reviewer] = at
+		}
+	}
+	return states
+}
+
+// approvalsReason returns the not enough approvals reason, with the number of approvals still required
+func approvalsReason(reviews *[]prp.Review, minReviewsRequired int) BlockingReason {
+	approved := 0
+	for _, state := range latestReviewStates(reviews) {
+		if state == "approved" {
+			approved++
+		}
+	}
+	missing := minReviewsRequired - approved
+	if missing < 0 {
+		missing = 0
+	}
+	return BlockingReason{
+		Code:              ReasonNotEnoughApprovals,
+		ApprovalsRequired: minReviewsRequired,
+		MissingApprovals:  missing,
+	}
+}
+
+// authorActionItemsReason returns the reason because of which the author needs to act on the reviews.
+// The changes requested by the reviewers take precedence over the unresolved review comments.
+func authorActionItemsReason(reviews *[]prp.Review, threads *[]prp.ReviewThread, author GithubUserName) BlockingReason {
+	changesRequestedBy := make([]GithubUserName, 0)
+	for reviewer, state := range latestReviewStates(reviews) {
+		if state == "changes_requested" {
+			changesRequestedBy = append(changesRequestedBy, reviewer)
+		}
+	}
+	if len(changesRequestedBy) > 0 {
+		sort.Slice(changesRequestedBy, func(i, j int) bool {
+			return changesRequestedBy[i] < changesRequestedBy[j]
+		})
+		return BlockingReason{Code: ReasonChangesRequested, ChangesRequestedBy: changesRequestedBy}
+	}
+
+	return BlockingReason{Code: ReasonUnresolvedThreads, UnresolvedThreads: unresolvedThreads(reviews, threads, author)}
+}
+
+// unresolvedThreads returns the number of unresolved review threads started by the reviewers (other than the
+// author) whose latest review is not an approval. The threads of a reviewer who approved are left to the author.
+func unresolvedThreads(reviews *[]prp.Review, threads *[]prp.ReviewThread, author GithubUserName) int {
+	if threads == nil {
+		return 0
+	}
+	states := latestReviewStates(reviews)
+	unresolved := 0
+	for _, thread := range *threads {
+		startedBy := GithubUserName(thread.Author)
+		if thread.Resolved || strings.EqualFold(string(startedBy), string(author)) {
+			continue
+		}
+		if states[startedBy] != "approved" {
+			unresolved++
+		}
+	}
+	return unresolved
+}
+
+// reRequestedReviewers returns the reviewers requested to review the PR again after their latest review, along
+// with the time of the request
+func reRequestedReviewers(reviews *[]prp.Review, requests *[]prp.ReviewRequest) map[GithubUserName]int64 {
+	reRequested := make(map[GithubUserName]int64)
+	if reviews == nil || requests == nil {
+		return reRequested
+	}
+	latestReviewAt := make(map[GithubUserName]int64)
+	for _, review := range *reviews {
+		if review.Reviewer == nil {
+			continue
+		}
+		reviewer := GithubUserName(*review.Reviewer)
+		var at int64
+		if review.SubmittedAt != nil {
+			at = *review.SubmittedAt
+		}
+		if last, exists := latestReviewAt[reviewer]; !exists || at > last {
+			latestReviewAt[reviewer] = at
+		}
+	}
+	for _, request := range *requests {
+		reviewedAt, reviewed := latestReviewAt[GithubUserName(request.Reviewer)]
+		if reviewed && request.RequestedAt > reviewedAt {
+			reRequested[GithubUserName(request.Reviewer)] = request.RequestedAt
+		}
+	}
+	return reRequested
+}
+
+// currentReviews returns the reviews, without the reviews of the re-requested reviewers submitted before they
+// were requested again
+func currentReviews(reviews *[]prp.Review, reRequested map[GithubUserName]int64) *[]prp.Review {
+	if reviews == nil || len(reRequested) == 0 {
+		return reviews
+	}
+	current := make([]prp.Review, 0, len(*reviews))
+	for _, review := range *reviews {
+		if review.Reviewer != nil && review.SubmittedAt != nil {
+			if requestedAt, found := reRequested[GithubUserName(*review.Reviewer)]; found && *review.SubmittedAt < requestedAt {
+				continue
+			}
+		}
+		current = append(current, review)
+	}
+	return &current
+}
+
+// currentThreads returns the review threads, without the threads started by the re-requested reviewers which
+// were last commented on before they were requested again. The re-requested reviewers are expected to resolve them.
+func currentThreads(threads *[]prp.ReviewThread, reRequested map[GithubUserName]int64) *[]prp.ReviewThread {
+	if threads == nil || len(reRequested) == 0 {
+		return threads
+	}
+	current := make([]prp.ReviewThread, 0, len(*threads))
+	for _, thread := range *threads {
+		if requestedAt, found := reRequested[GithubUserName(thread.Author)]; found && thread.LastCommentAt < requestedAt {
+			continue
+		}
+		current = append(current, thread)
+	}
+	return &current
+}
+
+// hasReviewed returns true if the reviewer has submitted any review on the PR
+func hasReviewed(reviews *[]prp.Review, reviewer GithubUserName) bool {
+	if reviews == nil {
+		return false
+	}
+	for _, review := range *reviews {
+		if review.Reviewer != nil && GithubUserName(*review.Reviewer) == reviewer {
+			return true
+		}
+	}
+	return false
+}
+
 // isPrReviewed Upon creating the pull request, authors typically add the reviewers
 // that they would like to get a review from for the specific change.
 // The reviewers are supposed to act on it and provide their comments.
@@ -131,13 +512,13 @@ func (actor *Actor) IdentifyActors(delayedPR prp.PRModel, repo repository.RepoMo
 func isPrReviewed(minReviewsRequired int, prDetails *github.PullRequest) bool {
 	reviewed := false
 	if minReviewsRequired > 0 {
-		if len(prDetails.RequestedReviewers) == 0 {
-			// Since there are no pending reviewers on the PR
+		if len(prDetails.RequestedReviewers) == 0 && len(prDetails.RequestedTeams) == 0 {
+			// Since there are no pending reviewers (or teams) on the PR
 			// it has been reviewed
 			reviewed = true
 		}
 	} else {
-		if len(prDetails.RequestedReviewers) == 0 {
+		if len(prDetails.RequestedReviewers) == 0 && len(prDetails.RequestedTeams) == 0 {
 			// Since there are no minimum reviews required
 			// and total reviewers are also zero PR state will be reviewed
 			reviewed = true
@@ -184,7 +565,8 @@ func isPrApproved(reviews *[]prp.Review, minReviewsRequired int) (bool, map[Gith
 
 			for _, v := range userReviewMap {
 				for _, r := range v {
-					if *r.ReviewState == "changes_requested" {
+					if *r.ReviewState == "changes_requested" || *r.ReviewState == prp.ReviewStateDismissed {
+						// A dismissed approval (e.g. a stale one, dismissed on push) no longer approves the PR
 						approvals = append(approvals, false)
 						break
 					} else if *r.ReviewState == "approved" {
@@ -228,21 +610,13 @@ func (bt byReviewTime) Less(i, j int) bool {
 // The author is responsible to address the review comments. Authors typically will
 // have two choices: If they agree with the review comment, then they can resolve it,
 // or if they disagree, then they can mark it as “won’t fix.” This condition is met if
-// the author has review comments that need to be addressed..
-func hasPendingActionItemsForAuthor(reviews *[]prp.Review) bool {
-	pendingForAuthor := false
-
-	if reviews != nil {
-		for _, review := range *reviews {
-			// Note: The review comments which are resolved have already been removed from
-			// the review state (during the webhook event). This means that any other state
-			// other than approved means that are some comments that need to be addressed.
-			if *review.ReviewState != "approved" {
-				pendingForAuthor = true
-				break
-			}
+// a reviewer's latest review requested changes, or if any unresolved review thread was
+// started by a reviewer whose latest review is not an approval.
+func hasPendingActionItemsForAuthor(reviews *[]prp.Review, threads *[]prp.ReviewThread, author GithubUserName) bool {
+	for _, state := range latestReviewStates(reviews) {
+		if state == "changes_requested" {
+			return true
 		}
 	}
-
-	return pendingForAuthor
+	return unresolvedThreads(reviews, threads, author) > 0
 }
@@ -37,34 +37,57 @@ func (m *GitHubProviderMock) GetBranchProtection(repo string, ref string, owner
 }
 
 func TestHasPendingActionItemsForAuthor(t *testing.T) {
+	now := time.Now().Unix()
+
 	t.Run("nil_reviews", func(t *testing.T) {
-		hasPending := hasPendingActionItemsForAuthor(nil)
+		hasPending := hasPendingActionItemsForAuthor(nil, nil, "author")
 		assert.False(t, hasPending)
 	})
 
 	t.Run("empty_reviews", func(t *testing.T) {
 		reviews := []prp.Review{}
-		hasPending := hasPendingActionItemsForAuthor(&reviews)
+		hasPending := hasPendingActionItemsForAuthor(&reviews, nil, "author")
 		assert.False(t, hasPending)
-	}) //TODO: MODIFY THIS CONDITION IN CODE
+	})
 
 	t.Run("all_approved", func(t *testing.T) {
 		reviews := []prp.Review{
-			{ReviewState: ptrString("approved")},
-			{ReviewState: ptrString("approved")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user2")},
 		}
-		hasPending := hasPendingActionItemsForAuthor(&reviews)
+		hasPending := hasPendingActionItemsForAuthor(&reviews, nil, "author")
 		assert.False(t, hasPending)
 	})
 
 	t.Run("some_not_approved", func(t *testing.T) {
 		reviews := []prp.Review{
-			{ReviewState: ptrString("changes_requested")},
-			{ReviewState: ptrString("approved")},
+			{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user2")},
 		}
-		hasPending := hasPendingActionItemsForAuthor(&reviews)
+		hasPending := hasPendingActionItemsForAuthor(&reviews, nil, "author")
 		assert.True(t, hasPending)
 	})
+
+	t.Run("unresolved_thread_of_reviewer_yet_to_approve", func(t *testing.T) {
+		reviews := []prp.Review{
+			{ReviewState: ptrString("commented"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+		}
+		threads := []prp.ReviewThread{{ThreadId: 1, Author: "user1"}}
+		assert.True(t, hasPendingActionItemsForAuthor(&reviews, &threads, "author"))
+
+		// Resolving the thread keeps the review, but nothing is left for the author
+		threads[0].Resolved = true
+		assert.False(t, hasPendingActionItemsForAuthor(&reviews, &threads, "author"))
+	})
+
+	t.Run("unresolved_thread_of_reviewer_who_approved", func(t *testing.T) {
+		reviews := []prp.Review{
+			{ReviewState: ptrString("commented"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now + 1), Reviewer: ptrString("user1")},
+		}
+		threads := []prp.ReviewThread{{ThreadId: 1, Author: "user1"}, {ThreadId: 2, Author: "author"}}
+		assert.False(t, hasPendingActionItemsForAuthor(&reviews, &threads, "author"))
+	})
 }
 
 func TestIsPrApproved(t *testing.T) {
@@ -153,4 +176,200 @@ func TestIsPrReviewed(t *testing.T) {
 		isReviewed := isPrReviewed(1, prDetails)
 		assert.False(t, isReviewed)
 	})
+
+	t.Run("requested_teams_present", func(t *testing.T) {
+		prDetails := &github.PullRequest{
+			RequestedReviewers: []*github.User{},
+			RequestedTeams: []*github.Team{
+				{Slug: github.String("backend")},
+			},
+		}
+		assert.False(t, isPrReviewed(1, prDetails))
+		assert.False(t, isPrReviewed(0, prDetails))
+	})
+}
+
+func TestIsCIFailing(t *testing.T) {
+	failure := prp.CIStateFailure
+	pending := prp.CIStatePending
+	prDetails := &github.PullRequest{
+		Head: &github.PullRequestBranch{SHA: github.String("abc")},
+	}
+
+	t.Run("no_ci_state", func(t *testing.T) {
+		assert.False(t, isCIFailing(prp.PRModel{HeadSHA: ptrString("abc")}, prDetails))
+	})
+
+	t.Run("ci_pending", func(t *testing.T) {
+		assert.False(t, isCIFailing(prp.PRModel{HeadSHA: ptrString("abc"), CIState: &pending}, prDetails))
+	})
+
+	t.Run("ci_failing", func(t *testing.T) {
+		assert.True(t, isCIFailing(prp.PRModel{HeadSHA: ptrString("abc"), CIState: &failure}, prDetails))
+	})
+
+	t.Run("ci_failing_on_previous_head", func(t *testing.T) {
+		assert.False(t, isCIFailing(prp.PRModel{HeadSHA: ptrString("def"), CIState: &failure}, prDetails))
+	})
+}
+
+func TestMergeBlockingReason(t *testing.T) {
+	protection := ReviewRequirements{Protected: true}
+
+	t.Run("mergeability_unknown", func(t *testing.T) {
+		assert.Equal(t, ReasonCode(""), mergeBlockingReason(&github.PullRequest{}, protection))
+	})
+
+	t.Run("mergeable", func(t *testing.T) {
+		prDetails := &github.PullRequest{Mergeable: github.Bool(true), MergeableState: github.String("clean")}
+		assert.Equal(t, ReasonCode(""), mergeBlockingReason(prDetails, protection))
+	})
+
+	t.Run("conflicted", func(t *testing.T) {
+		prDetails := &github.PullRequest{Mergeable: github.Bool(false), MergeableState: github.String("dirty")}
+		assert.Equal(t, ReasonMergeConflict, mergeBlockingReason(prDetails, protection))
+	})
+
+	t.Run("behind_protected_base", func(t *testing.T) {
+		prDetails := &github.PullRequest{Mergeable: github.Bool(true), MergeableState: github.String("behind")}
+		assert.Equal(t, ReasonBehindBase, mergeBlockingReason(prDetails, protection))
+	})
+
+	t.Run("behind_unprotected_base", func(t *testing.T) {
+		prDetails := &github.PullRequest{Mergeable: github.Bool(true), MergeableState: github.String("behind")}
+		assert.Equal(t, ReasonCode(""), mergeBlockingReason(prDetails, ReviewRequirements{}))
+	})
+}
+
+func TestApprovalsReason(t *testing.T) {
+	now := time.Now().Unix()
+	reviews := []prp.Review{
+		{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+		{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now + 1), Reviewer: ptrString("user1")},
+		{ReviewState: ptrString("commented"), SubmittedAt: ptrInt64(now + 2), Reviewer: ptrString("user2")},
+	}
+
+	reason := approvalsReason(&reviews, 3)
+	assert.Equal(t, BlockingReason{Code: ReasonNotEnoughApprovals, ApprovalsRequired: 3, MissingApprovals: 2}, reason)
+
+	reason = approvalsReason(nil, 0)
+	assert.Equal(t, 0, reason.MissingApprovals)
+}
+
+func TestAuthorActionItemsReason(t *testing.T) {
+	now := time.Now().Unix()
+
+	t.Run("changes_requested", func(t *testing.T) {
+		reviews := []prp.Review{
+			{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user2")},
+			{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+			{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user3")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now + 1), Reviewer: ptrString("user3")},
+		}
+		reason := authorActionItemsReason(&reviews, nil, "author")
+		assert.Equal(t, ReasonChangesRequested, reason.Code)
+		assert.Equal(t, []GithubUserName{"user1", "user2"}, reason.ChangesRequestedBy)
+	})
+
+	t.Run("unresolved_threads", func(t *testing.T) {
+		reviews := []prp.Review{
+			{ReviewState: ptrString("commented"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+			{ReviewState: ptrString("commented"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user2")},
+			{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user3")},
+		}
+		threads := []prp.ReviewThread{
+			{ThreadId: 1, ReviewId: 1, Author: "user1"},
+			{ThreadId: 2, ReviewId: 1, Author: "user1"},
+			{ThreadId: 3, ReviewId: 2, Author: "user2", Resolved: true},
+			{ThreadId: 4, ReviewId: 3, Author: "user3"},
+		}
+		reason := authorActionItemsReason(&reviews, &threads, "author")
+		assert.Equal(t, BlockingReason{Code: ReasonUnresolvedThreads, UnresolvedThreads: 2}, reason)
+	})
+}
+
+func TestReRequestedReviewers(t *testing.T) {
+	now := time.Now().Unix()
+	reviews := []prp.Review{
+		{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+		{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user2")},
+		{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user3")},
+		{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now + 20), Reviewer: ptrString("user3")},
+	}
+	requests := []prp.ReviewRequest{
+		{Reviewer: "user1", RequestedAt: now + 10},
+		{Reviewer: "user2", RequestedAt: now - 10},
+		{Reviewer: "user3", RequestedAt: now + 10},
+		// Yet to review the PR at all
+		{Reviewer: "user4", RequestedAt: now + 10},
+	}
+	reRequested := reRequestedReviewers(&reviews, &requests)
+	assert.Equal(t, map[GithubUserName]int64{"user1": now + 10}, reRequested)
+
+	current := currentReviews(&reviews, reRequested)
+	assert.Len(t, *current, 3)
+	assert.False(t, hasReviewed(current, "user1"))
+	// The changes requested by a re-requested reviewer no longer block the author
+	assert.False(t, hasPendingActionItemsForAuthor(current, nil, "author"))
+	isApproved, _ := isPrApproved(current, 2)
+	assert.True(t, isApproved)
+
+	threads := []prp.ReviewThread{
+		{ThreadId: 1, Author: "user1", LastCommentAt: now},
+		{ThreadId: 2, Author: "user1", LastCommentAt: now + 15},
+	}
+	assert.Equal(t, []prp.ReviewThread{threads[1]}, *currentThreads(&threads, reRequested))
+	assert.Equal(t, &reviews, currentReviews(&reviews, nil))
+}
+
+func TestDismissedApprovals(t *testing.T) {
+	now := time.Now().Unix()
+	reviews := []prp.Review{
+		{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("user1")},
+		// Dismissed as stale when new commits were pushed
+		{ReviewState: ptrString(prp.ReviewStateDismissed), SubmittedAt: ptrInt64(now + 1), Reviewer: ptrString("user1")},
+		{ReviewState: ptrString(prp.ReviewStateDismissed), SubmittedAt: ptrInt64(now + 1), Reviewer: ptrString("user2")},
+	}
+	isApproved, _ := isPrApproved(&reviews, 2)
+	assert.False(t, isApproved)
+	// The changes requested before the approval no longer block the author
+	assert.False(t, hasPendingActionItemsForAuthor(&reviews, nil, "author"))
+	assert.Equal(t, 2, approvalsReason(&reviews, 2).MissingApprovals)
+}
+
+func TestHasReviewed(t *testing.T) {
+	reviews := []prp.Review{{ReviewState: ptrString("commented"), Reviewer: ptrString("user1")}}
+	assert.True(t, hasReviewed(&reviews, "user1"))
+	assert.False(t, hasReviewed(&reviews, "user2"))
+	assert.False(t, hasReviewed(nil, "user1"))
+}
+
+func TestSortActors(t *testing.T) {
+	actors := []ActorDetails{
+		{IsReviewer: true, GithubUserName: "charlie"},
+		{IsReviewer: true, GithubUserName: "alice"},
+		{IsReviewer: true, GithubUserName: "bob"},
+	}
+	sortActors(actors)
+	assert.Equal(t, []GithubUserName{"alice", "bob", "charlie"}, []GithubUserName{actors[0].GithubUserName, actors[1].GithubUserName, actors[2].GithubUserName})
+}
+
+func TestFilterPendingCodeOwners(t *testing.T) {
+	now := time.Now().Unix()
+	reviews := []prp.Review{
+		{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("alice")},
+		{ReviewState: ptrString("changes_requested"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("bob")},
+		{ReviewState: ptrString("approved"), SubmittedAt: ptrInt64(now), Reviewer: ptrString("dave")},
+	}
+	teamMembers := map[string][]string{
+		"acme/backend":  {"carol", "dave"},
+		"acme/frontend": {"erin", "author"},
+	}
+
+	pending := filterPendingCodeOwners(
+		[]string{"author", "alice", "bob", "acme/backend", "acme/frontend"},
+		"author", &reviews, teamMembers)
+	assert.Equal(t, []string{"bob", "acme/frontend"}, pending)
+
+	assert.Empty(t, filterPendingCodeOwners(nil, "author", nil, nil))
 }
@@ -0,0 +1,118 @@
+package actor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeOwnersRule is a line of the CODEOWNERS file, assigning the owners to the files matching the pattern
+type CodeOwnersRule struct {
+	Pattern string
+	Owners  []string
+	matcher *regexp.Regexp
+}
+
+// ParseCodeOwners parses the content of the CODEOWNERS file. The owners are the users (@user) and the
+// teams (@org/team) of the rules, without the @. The owners given as email addresses are skipped, since
+// they cannot be mentioned. Lines with an invalid pattern are skipped, as GitHub does.
+// Reference: https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners#codeowners-syntax
+func ParseCodeOwners(content string) []CodeOwnersRule {
+	rules := make([]CodeOwnersRule, 0)
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		matcher, err := regexp.Compile(codeOwnersPatternToRegex(fields[0]))
+		if err != nil {
+			continue
+		}
+		owners := make([]string, 0)
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "@") {
+				owners = append(owners, strings.TrimPrefix(owner, "@"))
+			}
+		}
+		rules = append(rules, CodeOwnersRule{
+			Pattern: fields[0],
+			Owners:  owners,
+			matcher: matcher,
+		})
+	}
+	return rules
+}
+
+// OwnersOf returns the owners of the file. The last rule matching the file takes precedence.
+func OwnersOf(rules []CodeOwnersRule, file string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matcher.MatchString(file) {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// CodeOwnersOfFiles returns the owners of the files, in the order they are first found
+func CodeOwnersOfFiles(rules []CodeOwnersRule, files []string) []string {
+	owners := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, owner := range OwnersOf(rules, file) {
+			if !seen[strings.ToLower(owner)] {
+				seen[strings.ToLower(owner)] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// codeOwnersPatternToRegex converts the gitignore style pattern of the CODEOWNERS file into a regular
+// expression matching the paths of the files. A pattern with a leading or middle slash is relative to
+// the root of the repository, any other pattern matches at any depth. A pattern matching a directory
+// matches all the files beneath it, unless its last segment has a wildcard.
+func codeOwnersPatternToRegex(pattern string) string {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if strings.Contains(pattern, "/") {
+		anchored = true
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	lastSegment := pattern[strings.LastIndex(pattern, "/")+1:]
+	if dirOnly {
+		re.WriteString("/.*$")
+	} else if strings.Contains(lastSegment, "*") && lastSegment != "**" {
+		// docs/* matches the files in docs, but not in its subdirectories
+		re.WriteString("$")
+	} else {
+		re.WriteString("(?:/.*)?$")
+	}
+	return re.String()
+}
@@ -0,0 +1,62 @@
+package actor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const codeOwners = `# Default owners
+*       @acme/maintainers
+
+*.js    @js-owner
+/build/ @build-owner
+docs/*  docs@example.com @docs-owner
+apps/   @apps-owner
+**/logs @logs-owner
+/scripts/generated.sh
+`
+
+func TestParseCodeOwners(t *testing.T) {
+	rules := ParseCodeOwners(codeOwners)
+	assert.Len(t, rules, 7)
+	assert.Equal(t, "*", rules[0].Pattern)
+	assert.Equal(t, []string{"acme/maintainers"}, rules[0].Owners)
+	// The owners given as email addresses are skipped
+	assert.Equal(t, []string{"docs-owner"}, rules[3].Owners)
+	assert.Empty(t, rules[6].Owners)
+}
+
+func TestOwnersOf(t *testing.T) {
+	rules := ParseCodeOwners(codeOwners)
+
+	testCases := []struct {
+		file     string
+		expected []string
+	}{
+		{"README.md", []string{"acme/maintainers"}},
+		{"web/src/index.js", []string{"js-owner"}},
+		{"build/release.sh", []string{"build-owner"}},
+		{"tools/build/release.sh", []string{"acme/maintainers"}},
+		{"docs/setup.md", []string{"docs-owner"}},
+		{"docs/api/setup.md", []string{"acme/maintainers"}},
+		{"apps/web/main.go", []string{"apps-owner"}},
+		{"services/apps/main.go", []string{"apps-owner"}},
+		{"logs/today.txt", []string{"logs-owner"}},
+		{"deploy/logs/today.txt", []string{"logs-owner"}},
+		{"scripts/generated.sh", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			assert.Equal(t, tc.expected, OwnersOf(rules, tc.file))
+		})
+	}
+
+	assert.Nil(t, OwnersOf(ParseCodeOwners("docs/ @docs-owner"), "README.md"))
+}
+
+func TestCodeOwnersOfFiles(t *testing.T) {
+	rules := ParseCodeOwners(codeOwners)
+	owners := CodeOwnersOfFiles(rules, []string{"web/index.js", "README.md", "web/app.js", "build/ci.sh"})
+	assert.Equal(t, []string{"js-owner", "acme/maintainers", "build-owner"}, owners)
+}
@@ -0,0 +1,83 @@
+package actor
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/go-github/v52/github"
+	provider "nudge/internal/provider/github"
+)
+
+// ReviewRequirements are the effective requirements to merge a PR into its base branch, from the
+// classic branch protection and the rulesets which apply to the branch. When several of them define
+// the same requirement, the strictest one applies.
+type ReviewRequirements struct {
+	// Protected is true if the branch has the classic branch protection or any ruleset rule
+	Protected                    bool
+	RequiredApprovingReviewCount int
+	RequireCodeOwnerReviews      bool
+	// DismissStaleReviews is true if the approvals are dismissed when new commits are pushed
+	DismissStaleReviews bool
+	// RequireUpToDate is true if the branch of the PR must be up-to-date with the base branch
+	RequireUpToDate bool
+}
+
+// FetchReviewRequirements returns the effective review requirements of the branch of the repository
+func FetchReviewRequirements(g *provider.GitHub, owner, repoName, branch string) (*ReviewRequirements, error) {
+	protection, protectionErr := g.GetBranchProtection(repoName, branch, owner)
+	if protectionErr != nil {
+		if !errors.Is(protectionErr, github.ErrBranchNotProtected) {
+			return nil, protectionErr
+		}
+		// If the branch is not protected, move ahead
+		protection = nil
+	}
+
+	rules, rulesErr := g.GetRulesForBranch(owner, repoName, branch)
+	if rulesErr != nil {
+		return nil, rulesErr
+	}
+
+	requirements := EffectiveReviewRequirements(protection, rules)
+	return &requirements, nil
+}
+
+// EffectiveReviewRequirements combines the classic branch protection (nil if the branch is not
+// protected) with the rules of the rulesets which apply to the branch
+func EffectiveReviewRequirements(protection *github.Protection, rules []*provider.BranchRule) ReviewRequirements {
+	requirements := ReviewRequirements{}
+	if protection != nil {
+		requirements.Protected = true
+		if protection.RequiredPullRequestReviews != nil {
+			reviews := protection.RequiredPullRequestReviews
+			requirements.RequiredApprovingReviewCount = reviews.RequiredApprovingReviewCount
+			requirements.RequireCodeOwnerReviews = reviews.RequireCodeOwnerReviews
+			requirements.DismissStaleReviews = reviews.DismissStaleReviews
+		}
+		if protection.RequiredStatusChecks != nil {
+			requirements.RequireUpToDate = protection.RequiredStatusChecks.Strict
+		}
+	}
+
+	for _, rule := range rules {
+		requirements.Protected = true
+		switch rule.Type {
+		case provider.RuleTypePullRequest:
+			var params provider.PullRequestRuleParameters
+			if len(rule.Parameters) == 0 || json.Unmarshal(rule.Parameters, &params) != nil {
+				continue
+			}
+			if params.RequiredApprovingReviewCount > requirements.RequiredApprovingReviewCount {
+				requirements.RequiredApprovingReviewCount = params.RequiredApprovingReviewCount
+			}
+			requirements.RequireCodeOwnerReviews = requirements.RequireCodeOwnerReviews || params.RequireCodeOwnerReview
+			requirements.DismissStaleReviews = requirements.DismissStaleReviews || params.DismissStaleReviewsOnPush
+		case provider.RuleTypeRequiredStatusChecks:
+			var params provider.RequiredStatusChecksRuleParameters
+			if len(rule.Parameters) == 0 || json.Unmarshal(rule.Parameters, &params) != nil {
+				continue
+			}
+			requirements.RequireUpToDate = requirements.RequireUpToDate || params.StrictRequiredStatusChecksPolicy
+		}
+	}
+	return requirements
+}
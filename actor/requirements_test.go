@@ -0,0 +1,67 @@
+package actor
+
+import (
+	"encoding/json"
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	provider "nudge/internal/provider/github"
+	"testing"
+)
+
+func TestEffectiveReviewRequirements(t *testing.T) {
+	pullRequestRule := func(params provider.PullRequestRuleParameters) *provider.BranchRule {
+		raw, _ := json.Marshal(params)
+		return &provider.BranchRule{Type: provider.RuleTypePullRequest, Parameters: raw}
+	}
+
+	t.Run("unprotected", func(t *testing.T) {
+		assert.Equal(t, ReviewRequirements{}, EffectiveReviewRequirements(nil, nil))
+	})
+
+	t.Run("classic_protection", func(t *testing.T) {
+		protection := &github.Protection{
+			RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+				RequiredApprovingReviewCount: 2,
+				RequireCodeOwnerReviews:      true,
+			},
+			RequiredStatusChecks: &github.RequiredStatusChecks{Strict: true},
+		}
+		assert.Equal(t, ReviewRequirements{
+			Protected:                    true,
+			RequiredApprovingReviewCount: 2,
+			RequireCodeOwnerReviews:      true,
+			RequireUpToDate:              true,
+		}, EffectiveReviewRequirements(protection, nil))
+	})
+
+	t.Run("rulesets", func(t *testing.T) {
+		rules := []*provider.BranchRule{
+			{Type: "deletion"},
+			pullRequestRule(provider.PullRequestRuleParameters{RequiredApprovingReviewCount: 1, DismissStaleReviewsOnPush: true}),
+			pullRequestRule(provider.PullRequestRuleParameters{RequiredApprovingReviewCount: 3}),
+			{Type: provider.RuleTypeRequiredStatusChecks, Parameters: json.RawMessage(`{"strict_required_status_checks_policy": true}`)},
+		}
+		assert.Equal(t, ReviewRequirements{
+			Protected:                    true,
+			RequiredApprovingReviewCount: 3,
+			DismissStaleReviews:          true,
+			RequireUpToDate:              true,
+		}, EffectiveReviewRequirements(nil, rules))
+	})
+
+	t.Run("classic_protection_and_rulesets", func(t *testing.T) {
+		protection := &github.Protection{
+			RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+				RequiredApprovingReviewCount: 2,
+			},
+		}
+		rules := []*provider.BranchRule{
+			pullRequestRule(provider.PullRequestRuleParameters{RequiredApprovingReviewCount: 1, RequireCodeOwnerReview: true}),
+		}
+		assert.Equal(t, ReviewRequirements{
+			Protected:                    true,
+			RequiredApprovingReviewCount: 2,
+			RequireCodeOwnerReviews:      true,
+		}, EffectiveReviewRequirements(protection, rules))
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"nudge/internal/database/repository"
 	uc "nudge/internal/database/user"
 	"nudge/internal/provider/github"
+	"nudge/repoconfig"
 	"strconv"
 	"strings"
 )
@@ -39,9 +40,7 @@ func handleGitHubAppCallback(c echo.Context) error {
 				lo.Fatalf("Failed to fetch user details from the oauth access token %v", meErr)
 				return meErr
 			}
-			jwt, _ := provider.GenerateAppJWT(app.ko.String("app.private_key"), app.ko.String("github.app_id"))
-			g = provider.Init(*jwt)
-			iToken, appTokenErr := g.GetAppInstallationAccessToken(installationId)
+			iToken, appTokenErr := appTokens(app).InstallationToken(installationId)
 			if appTokenErr != nil {
 
 			}
@@ -53,7 +52,7 @@ func handleGitHubAppCallback(c echo.Context) error {
 				GitHubRefreshToken: tokenDetails.RefreshToken,
 			}
 			uModel.GitHubApp = uc.GitHubAppModel{
-				GitHubInstallationAccessToken: iToken.GetToken(),
+				GitHubInstallationAccessToken: iToken,
 				InstallationId:                installationId,
 			}
 			if me.Login != nil {
@@ -119,14 +118,27 @@ func populateActivePRs(app *App, appAccessToken string, repos []*github.Reposito
 	prStateToFetch := "open"
 	prModel := prp.Init(app.db)
 	for _, repo := range repos {
-		prs, prErr := g.GetPRs(*repo.Owner.Login, *repo.Name, &prStateToFetch)
+		prs, prErr := g.GetPRs(*repo.Owner.Login, *repo.Name, &prStateToFetch, 0, nil)
 		if prErr != nil {
 			app.log.Printf("Failed to fetch PR details for repo %s %v", *repo.Name, prErr)
 			continue
 		}
+		config := repoconfig.ForRepository(app.ko, fetchRepoConfig(app, g, *repo.Owner.Login, *repo.Name, *repo.ID))
+		// Most of the PRs share the same base branch, fetch its protection only once
+		protectedBranches := make(map[string]bool)
+		lifeTime := func(pr *github.PullRequest) int {
+			base := pr.GetBase().GetRef()
+			protected, fetched := protectedBranches[base]
+			if !fetched && len(base) > 0 {
+				protected = isBranchProtected(app, g, *repo.Owner.Login, *repo.Name, base)
+				protectedBranches[base] = protected
+			}
+			// The PRs are listed without their size
+			return estimateLifeTime(app, withSize(app, g, *repo.Owner.Login, *repo.Name, pr), *repo.ID, repo.GetFullName(), protected)
+		}
 		prModelList := make([]*prp.PRModel, 0)
 		for _, pr := range prs {
-			if app.ko.Bool("bot.ignore_bot_prs") {
+			if config.Bool("bot.ignore_bot_prs") {
 				if pr.User != nil && pr.User.Type != nil && strings.ToLower(*pr.User.Type) == "bot" {
 					// Ignore the PRs raised by bots!
 					app.log.Printf("Ignoring the PR#%d for repo %s raised by bot", *pr.Number, *repo.Name)
@@ -134,7 +146,7 @@ func populateActivePRs(app *App, appAccessToken string, repos []*github.Reposito
 				} else {
 					// Since user is not defined (and its type is not known)
 					// add to the PR list
-					model := prp.CreateDataModelForPR(*pr, *repo.ID)
+					model := prp.CreateDataModelForPR(*pr, *repo.ID, lifeTime(pr))
 					prModelList = append(prModelList, model)
 					if pr.User != nil && pr.User.Type != nil {
 						app.log.Printf("User type detected as %s for PR#%d for repo %s", strings.ToLower(*pr.User.Type), *pr.Number, *repo.Name)
@@ -142,7 +154,7 @@ func populateActivePRs(app *App, appAccessToken string, repos []*github.Reposito
 				}
 			} else {
 				// Also include the PRs raised by the bots
-				model := prp.CreateDataModelForPR(*pr, *repo.ID)
+				model := prp.CreateDataModelForPR(*pr, *repo.ID, lifeTime(pr))
 				prModelList = append(prModelList, model)
 			}
 		}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	prp "nudge/internal/database/pr"
+	time2 "nudge/internal/time"
+)
+
+// handleCheckSuite records the conclusion of a completed check suite. The suites which are
+// requested are not recorded, since GitHub creates a suite for every app with access to the
+// checks, even if the app never runs any check on the commit.
+func handleCheckSuite(event github.CheckSuiteEvent, app *App) error {
+	if event.GetAction() != "completed" || event.CheckSuite == nil {
+		return nil
+	}
+	suite := event.GetCheckSuite()
+	return recordCICheck(app, event.GetRepo().GetID(), suite.GetHeadSHA(), prp.CICheck{
+		Name:  "check_suite:" + suite.GetApp().GetSlug(),
+		State: prp.CheckRunState(suite.GetStatus(), suite.GetConclusion()),
+	})
+}
+
+// handleCheckRun records the state of the check run on the PRs of its head commit
+func handleCheckRun(event github.CheckRunEvent, app *App) error {
+	if event.CheckRun == nil {
+		return nil
+	}
+	run := event.GetCheckRun()
+	return recordCICheck(app, event.GetRepo().GetID(), run.GetHeadSHA(), prp.CICheck{
+		Name:  "check_run:" + run.GetApp().GetSlug() + "/" + run.GetName(),
+		State: prp.CheckRunState(run.GetStatus(), run.GetConclusion()),
+	})
+}
+
+// handleStatus records the commit status on the PRs of the commit
+func handleStatus(event github.StatusEvent, app *App) error {
+	return recordCICheck(app, event.GetRepo().GetID(), event.GetSHA(), prp.CICheck{
+		Name:  "status:" + event.GetContext(),
+		State: prp.CommitStatusState(event.GetState()),
+	})
+}
+
+func recordCICheck(app *App, repoId int64, headSHA string, check prp.CICheck) error {
+	if repoId == 0 || len(headSHA) == 0 {
+		return nil
+	}
+	nudgeTime := new(time2.NudgeTime)
+	check.UpdatedAt = nudgeTime.NudgeTime().Unix()
+	err := prp.Init(app.db).UpdateCICheck(repoId, headSHA, check)
+	if err != nil {
+		return fmt.Errorf("failed to record the %s check of commit %s - %w", check.Name, headSHA, err)
+	}
+	return nil
+}
+
+// resetCI clears the checks of the previous head commit once new commits are pushed to the PR
+func resetCI(pr github.PullRequestEvent, app *App) error {
+	headSHA := pr.GetPullRequest().GetHead().GetSHA()
+	if len(headSHA) == 0 {
+		return nil
+	}
+	err := prp.Init(app.db).ResetCI(pr.GetPullRequest().GetID(), headSHA)
+	if err != nil {
+		return fmt.Errorf("failed to reset the checks of PR %d - %w", pr.GetNumber(), err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"nudge/actor"
+	"nudge/command"
+	prp "nudge/internal/database/pr"
+	"nudge/internal/database/repository"
+	provider "nudge/internal/provider/github"
+	time2 "nudge/internal/time"
+	"nudge/notify"
+	"nudge/repoconfig"
+	"strings"
+	"time"
+)
+
+// handleIssueComment acts on the /nudge command of a new comment on a PR, and replies to the commenter.
+// The commenter must be allowed to use the command by their permission on the repository.
+func handleIssueComment(event github.IssueCommentEvent, app *App) {
+	if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() || event.Installation == nil {
+		return
+	}
+	commenter := event.GetComment().GetUser().GetLogin()
+	if isNudgeBot(commenter, app) {
+		return
+	}
+	c, parseErr := command.Parse(event.GetComment().GetBody())
+	if c == nil && parseErr == nil {
+		return
+	}
+
+	repo := event.GetRepo()
+	prModel, err := prp.Init(app.db).FindByNumber(repo.GetID(), event.GetIssue().GetNumber())
+	if err != nil {
+		// The PR is not monitored
+		app.log.Printf("Ignoring the command on PR %d of repo %s - %v", event.GetIssue().GetNumber(), repo.GetName(), err)
+		return
+	}
+	g, err := installationClient(app, event.Installation.GetID())
+	if err != nil {
+		app.log.Printf("Failed to fetch app access token while handling the command on PR %d - %v", prModel.Number, err)
+		return
+	}
+	reply := func(message string) {
+		if rErr := g.PostComment(repo.GetName(), repo.GetOwner().GetLogin(), prModel.Number, fmt.Sprintf("@%s %s", commenter, message)); rErr != nil {
+			app.log.Printf("Failed to reply to the command on PR %d of repo %s - %v", prModel.Number, repo.GetName(), rErr)
+		}
+	}
+	if parseErr != nil {
+		reply(fmt.Sprintf("%s. Available commands: `/nudge snooze [<n><h|d|w>]`, `/nudge stop`, `/nudge resume` and `/nudge why`.", parseErr))
+		return
+	}
+
+	isAuthor := prModel.Author != nil && strings.EqualFold(*prModel.Author, commenter)
+	permission, err := g.GetPermissionLevel(repo.GetOwner().GetLogin(), repo.GetName(), commenter)
+	if err != nil {
+		if !provider.IsNotFound(err) {
+			app.log.Printf("Failed to fetch the permission of %s on repo %s - %v", commenter, repo.GetName(), err)
+			return
+		}
+		permission = "none"
+	}
+	if !command.Allowed(*c, permission, isAuthor) {
+		app.log.Printf("%s (%s) is not allowed to use /nudge %s on PR %d of repo %s", commenter, permission, c.Name, prModel.Number, repo.GetName())
+		reply(fmt.Sprintf("only the author of the PR and the collaborators with write access can use `/nudge %s`.", c.Name))
+		return
+	}
+
+	message, err := runCommand(*c, *prModel, app)
+	if err != nil {
+		app.log.Printf("Failed to run /nudge %s on PR %d of repo %s - %v", c.Name, prModel.Number, repo.GetName(), err)
+		reply(fmt.Sprintf("sorry, `/nudge %s` failed. Please try again later.", c.Name))
+		return
+	}
+	reply(message)
+}
+
+// runCommand runs the command on the PR, and returns the reply to the commenter
+func runCommand(c command.Command, prModel prp.PRModel, app *App) (string, error) {
+	prs := prp.Init(app.db)
+	switch c.Name {
+	case command.Snooze:
+		nudgeTime := new(time2.NudgeTime)
+		until := nudgeTime.NudgeTime().Add(c.Duration)
+		snoozedUntil := until.Unix()
+		if err := prs.UpdateSnooze(prModel.PRID, &snoozedUntil); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("the nudges of this PR are snoozed until %s.", until.UTC().Format("Mon, 02 Jan 2006 15:04 MST")), nil
+	case command.Stop:
+		if err := prs.UpdateNudgeDisabled(prModel.PRID, true); err != nil {
+			return "", err
+		}
+		return "the nudges of this PR are stopped. Comment `/nudge resume` to resume them.", nil
+	case command.Resume:
+		if err := prs.UpdateNudgeDisabled(prModel.PRID, false); err != nil {
+			return "", err
+		}
+		if err := prs.UpdateSnooze(prModel.PRID, nil); err != nil {
+			return "", err
+		}
+		return "the nudges of this PR are resumed.", nil
+	case command.Why:
+		repo, err := repository.Init(app.db).FindByRepoId(prModel.RepoId)
+		if err != nil {
+			return "", err
+		}
+		config := repoconfig.ForRepository(app.ko, repo.Config)
+		actors, err := new(actor.Actor).IdentifyActors(prModel, *repo, config)
+		if err != nil {
+			return "", err
+		}
+		return notify.CreateVerdictMessage(config, prModel, actors, time.Now()), nil
+	default:
+		return "", errors.New("unknown command " + string(c.Name))
+	}
+}
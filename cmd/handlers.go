@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"expvar"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"io"
 	"net/http"
+	"nudge/notify"
+	"strings"
+	"time"
 )
 
 type okResp struct {
@@ -31,17 +38,72 @@ func initHTTPHandlers(e *echo.Echo, app *App) {
 		e.DefaultHTTPErrorHandler(err, c)
 	}
 
+	internalAuth := verifyInternalToken(app.ko.String("server.internal_token"))
+
 	e.GET("/ping", handlePing)
+	// Counters of the server, e.g. the rejected webhook deliveries (github_webhook_rejections). They are internal,
+	// since the variables also expose the command line and the memory statistics.
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()), internalAuth)
 
 	// Public Endpoints For GitHub Callbacks
 	g.GET("/github/app/callback", handleGitHubAppCallback)
 	g.POST("/github/app/webhook", handleWebhook)
 	g.GET("/github/oauth/callback", handleGitHubOauth)
 
-	// Public Endpoints for Slack Callbacks
+	// Public Endpoints for Slack Callbacks. They must be signed with the signing secret of the Slack app.
+	slackAuth := verifySlackSignature(notify.NewSlackVerifier(app.ko.String("slack.signing_secret")))
+	g.POST("/slack/command/map-github", handleSlackMappingCommand, slackAuth)
+	g.POST("/slack/message_action", handleSlackMessageAction, slackAuth)
+	// The OAuth redirect of the Slack app, and the mapping submitted by its page with the Slack access token
 	g.GET("/slack/auth", handleSlackAuthRequest)
 	g.POST("/slack/github", storeGitHubSlackMapping)
-	g.POST("/slack/command/map-github", handleSlackMappingCommand)
-	// the following endpoint is internal [does not use auth as of today]
-	g.POST("/slack/users", storeGitHubSlackMappingAfterInstallation)
+	// the following endpoint is internal
+	g.POST("/slack/users", storeGitHubSlackMappingAfterInstallation, internalAuth)
+}
+
+// verifyInternalToken rejects the requests to the internal endpoints without the bearer token (server.internal_token).
+// Every request is rejected while the token is not configured.
+func verifyInternalToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var (
+				app = c.Get("app").(*App)
+				req = c.Request()
+			)
+
+			bearer := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if len(token) == 0 || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				app.log.Printf("Rejected the request to %s from %s - invalid internal token", req.URL.Path, c.RealIP())
+				return c.String(http.StatusUnauthorized, "unauthorized")
+			}
+			return next(c)
+		}
+	}
+}
+
+// verifySlackSignature rejects the requests whose X-Slack-Signature does not match their body and
+// X-Slack-Request-Timestamp, as well as the replayed requests
+func verifySlackSignature(verifier *notify.SlackVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var (
+				app = c.Get("app").(*App)
+				req = c.Request()
+			)
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "bad request")
+			}
+			// The handler binds the body again
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			err = verifier.Verify(req.Header.Get("X-Slack-Request-Timestamp"), req.Header.Get("X-Slack-Signature"), body, time.Now())
+			if err != nil {
+				app.log.Printf("Rejected the request to %s from %s - %v", req.URL.Path, c.RealIP(), err)
+				return c.String(http.StatusUnauthorized, "unauthorized")
+			}
+			return next(c)
+		}
+	}
 }
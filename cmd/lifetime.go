@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"github.com/google/go-github/v52/github"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"nudge/actor"
+	"nudge/internal/database/lifetime"
+	"nudge/internal/database/outcome"
+	prp "nudge/internal/database/pr"
+	"nudge/internal/database/repository"
+	provider "nudge/internal/provider/github"
+	"nudge/prediction"
+)
+
+// estimateLifeTime predicts the lifetime (in hours) of the pull request using the predictor
+// chosen for the repository (repoFullName)
+func estimateLifeTime(app *App, pr github.PullRequest, repoId int64, repoFullName string, protectedBase bool) int {
+	features := prediction.ExtractFeatures(pr)
+	features.RepoId = repoId
+	features.Repository = repoFullName
+	features.ProtectedBase = protectedBase
+	if pr.User != nil && pr.User.Login != nil {
+		features.AuthorMergeHours = authorMergeHours(app.db, app.log, repoId, *pr.User.Login)
+	}
+
+	return app.predictor.EstimateLifeTime(features)
+}
+
+// authorMergeHours returns the lifetimes of the PRs merged by the author in the repository, or none if the merge
+// history could not be fetched
+func authorMergeHours(db *mongo.Database, lo *log.Logger, repoId int64, author string) []float64 {
+	hours, err := outcome.Init(db).AuthorMergeHours(repoId, author)
+	if err != nil {
+		lo.Printf("Failed to fetch the merge history of %s. Estimating without it - %v", author, err)
+		return nil
+	}
+	return hours
+}
+
+// estimateMissingLifeTimes predicts, with the predictor of the workflow, the lifetime of the open PRs recorded
+// without one, which would otherwise be delayed as soon as they are checked. The size of the PR is not stored, so
+// the lifetime is estimated from its repository, reviewers and author.
+func estimateMissingLifeTimes(predictor prediction.LifetimePredictor, db *mongo.Database) {
+	repoList, err := repository.Init(db).GetAll()
+	if err != nil {
+		lo.Printf("Failed to fetch the repositories to estimate the missing lifetimes %v", err)
+		return
+	}
+
+	prs := prp.Init(db)
+	for _, repo := range *repoList {
+		openPRs, prErr := prs.GetOpenPRs(repo.RepoId)
+		if prErr != nil {
+			lo.Printf("Failed to fetch the open PRs of repository %s %v", repo.Name, prErr)
+			continue
+		}
+		for _, pr := range *openPRs {
+			if pr.LifeTime > 0 {
+				continue
+			}
+			features := prediction.Features{
+				RepoId:     repo.RepoId,
+				Repository: repo.Owner + "/" + repo.Name,
+			}
+			if pr.RequestedReviewers != nil {
+				features.Reviewers = len(*pr.RequestedReviewers)
+			}
+			if pr.Author != nil {
+				features.AuthorMergeHours = authorMergeHours(db, lo, repo.RepoId, *pr.Author)
+			}
+			lifeTime := predictor.EstimateLifeTime(features)
+			if _, uErr := prs.UpdateLifeTime(pr.PRID, prp.LifeTimeRevision{LifeTime: lifeTime, Action: "workflow"}); uErr != nil {
+				lo.Printf("Failed to store the lifetime of PR#%d of repository %s %v", pr.Number, repo.Name, uErr)
+				continue
+			}
+			lo.Printf("Estimated the missing lifetime of PR#%d of repository %s to %d hours", pr.Number, repo.Name, lifeTime)
+		}
+	}
+}
+
+// withSize returns the pull request along with its size (lines, files and commits), which the list API does not
+// return. The listed pull request is returned if it could not be fetched.
+func withSize(app *App, g *provider.GitHub, owner, repoName string, pr *github.PullRequest) github.PullRequest {
+	details, err := g.GetPrById(pr.GetNumber(), owner, repoName)
+	if err != nil {
+		app.log.Printf("Failed to fetch PR#%d of repository %s. Estimating its lifetime without its size - %v", pr.GetNumber(), repoName, err)
+		return *pr
+	}
+	return *details
+}
+
+// reviseLifeTime re-estimates the lifetime of the pull request whose size or scope has changed, and
+// records the revision on the PR if the predicted lifetime has changed. Returns the new lifetime.
+func reviseLifeTime(pr github.PullRequestEvent, app *App) int {
+	lifeTime := estimateLifeTimeForEvent(pr, app)
+	revision := prp.CreateLifeTimeRevision(*pr.PullRequest, lifeTime, *pr.Action)
+	revised, err := prp.Init(app.db).UpdateLifeTime(*pr.PullRequest.ID, revision)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			app.log.Printf("Failed to revise the lifetime of PR %d of repo %s - %v", *pr.Number, *pr.Repo.Name, err)
+		}
+		return lifeTime
+	}
+	if revised {
+		app.log.Printf("Revised the lifetime of PR %d of repo %s to %d hours on %s", *pr.Number, *pr.Repo.Name, lifeTime, *pr.Action)
+	}
+	return lifeTime
+}
+
+// isBranchProtected returns true if the branch has the classic branch protection enabled, or any ruleset
+// which applies to it. If the protection could not be fetched, the branch is considered to be unprotected.
+func isBranchProtected(app *App, g *provider.GitHub, owner, repoName, branch string) bool {
+	requirements, err := actor.FetchReviewRequirements(g, owner, repoName, branch)
+	if err != nil {
+		app.log.Printf("Failed to fetch the branch protection for %s of %s - %v", branch, repoName, err)
+		return false
+	}
+	return requirements.Protected
+}
+
+// recordPROutcome stores the outcome of the merged pull request, which feeds the merge history
+// used for the lifetime prediction and the training of the lifetime models
+func recordPROutcome(pr github.PullRequestEvent, app *App) {
+	if pr.PullRequest.MergedAt == nil || pr.Installation == nil {
+		return
+	}
+	g, err := installationClient(app, *pr.Installation.ID)
+	if err != nil {
+		app.log.Printf("Failed to fetch app access token while recording the outcome of PR %d - %v", *pr.Number, err)
+		return
+	}
+	reviews, rErr := g.GetPRReviews(*pr.Repo.Owner.Login, *pr.Repo.Name, *pr.Number)
+	if rErr != nil {
+		app.log.Printf("Failed to fetch the reviews of PR %d of repo %s. Recording without them - %v", *pr.Number, *pr.Repo.Name, rErr)
+	}
+	model := outcome.CreateDataModelForOutcome(*pr.PullRequest, *pr.Repo.ID, reviews)
+	if uErr := outcome.Init(app.db).BulkUpsert([]*outcome.OutcomeModel{model}); uErr != nil {
+		app.log.Printf("Failed to record the outcome of PR %d of repo %s - %v", *pr.Number, *pr.Repo.Name, uErr)
+	}
+}
+
+// deleteLifetimeHistory removes the recorded outcomes and the trained lifetime model of the repository
+func deleteLifetimeHistory(app *App, repoId int64) {
+	if err := outcome.Init(app.db).DeleteAll(repoId); err != nil {
+		app.log.Printf("Failed to delete the PR outcomes of repository %d %v", repoId, err)
+	}
+	if err := lifetime.Init(app.db).DeleteOne(repoId); err != nil {
+		app.log.Printf("Failed to delete the lifetime model of repository %d %v", repoId, err)
+	}
+}
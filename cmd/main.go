@@ -15,8 +15,11 @@ import (
 	"nudge/internal/awslog"
 	"nudge/internal/buflog"
 	dbp "nudge/internal/database"
+	"nudge/internal/database/lifetime"
+	"nudge/internal/database/outcome"
 	"nudge/internal/database/user"
 	"nudge/notify"
+	"nudge/prediction"
 	"os"
 	"os/signal"
 	"syscall"
@@ -24,10 +27,11 @@ import (
 )
 
 type App struct {
-	log *log.Logger
-	ko  *koanf.Koanf
-	dbc *mongo.Client
-	db  *mongo.Database
+	log       *log.Logger
+	ko        *koanf.Koanf
+	dbc       *mongo.Client
+	db        *mongo.Database
+	predictor prediction.LifetimePredictor
 }
 
 var (
@@ -40,7 +44,8 @@ var (
 	dbCtx          context.Context
 )
 
-func initFlags() {
+// initFlags loads the commandline flags and returns the remaining arguments (the subcommand)
+func initFlags() []string {
 	f := flag.NewFlagSet("config", flag.ContinueOnError)
 	// Register the commandline flags.
 	f.String("config", "config.yml", "path to config file")
@@ -51,11 +56,12 @@ func initFlags() {
 	if err := ko.Load(posflag.Provider(f, ".", ko), nil); err != nil {
 		lo.Fatalf("error loading config: %v", err)
 	}
+	return f.Args()
 }
 
 func main() {
 	lo.Printf("TZ:%s", os.Getenv("TZ"))
-	initFlags()
+	args := initFlags()
 	if err := ko.Load(file.Provider(ko.String("config")), yaml.Parser()); err != nil {
 		lo.Fatalf("error loading config from config.yml %v", err)
 	}
@@ -85,17 +91,44 @@ func main() {
 	databaseClient, dbCtx = initDatabaseConnection()
 	database = databaseClient.Database(ko.String("mongo.database"))
 	// Creates the database indexes if it does not exist
-	dbp.SyncIndexes(database)
+	dbp.SyncIndexes(database, lo)
 	defer databaseClient.Disconnect(dbCtx)
 
+	predictor, predictorErr := prediction.NewPredictor(ko, outcome.Init(database), lifetime.Init(database))
+	if predictorErr != nil {
+		lo.Fatalf("Failed to initialize the lifetime predictor %v", predictorErr)
+	}
+
 	app := &App{
-		log: lo,
-		ko:  ko,
-		dbc: databaseClient,
-		db:  database,
+		log:       lo,
+		ko:        ko,
+		dbc:       databaseClient,
+		db:        database,
+		predictor: predictor,
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "train":
+			// nudge train: backfill the merged PRs and fit the lifetime models
+			trainLifetimeModels(app)
+		case "replay-webhooks":
+			// nudge replay-webhooks [delivery-id...]: queue the dead letters again
+			replayWebhookDeadLetters(app, args[1:])
+		case "reconcile":
+			// nudge reconcile: re-sync the open PRs of every repository with GitHub
+			reconcilePRs(app)
+		default:
+			lo.Printf("Unknown command %s. Available commands: train, replay-webhooks, reconcile", args[0])
+		}
+		return
 	}
 
+	stopWebhookWorkers := startWebhookWorkers(app)
 	srv := initHTTPServer(app)
+	// Cache the configuration file of every repository, before the first workflow run
+	syncRepoConfigs(app)
+	startReconciler(app)
 
 	ticker := time.NewTicker(time.Hour * ko.Duration("bot.next_check_in.time"))
 	if ko.String("bot.next_check_in.unit") == "m" {
@@ -109,6 +142,7 @@ func main() {
 	deps.NotificationHours = new(notify.BusinessHours)
 	deps.User = user.Init(database)
 	deps.NotificationDays = &notify.NotificationDays{Lo: lo}
+	deps.LifetimePredictor = predictor
 	Workflow(*deps)
 	go func() {
 		for {
@@ -135,6 +169,8 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 		srv.Shutdown(ctx)
+		// The deliveries being processed are claimed again by the next process once their lease expires
+		stopWebhookWorkers()
 
 		// Signal the close.
 		closerWait <- true
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	prp "nudge/internal/database/pr"
+	"nudge/internal/database/repository"
+	provider "nudge/internal/provider/github"
+	"nudge/reconcile"
+	"nudge/repoconfig"
+	"time"
+)
+
+// driftCorrected counts the PRs whose drift from GitHub was corrected by the reconciler, by kind of drift
+var driftCorrected = expvar.NewMap("reconciler_drift_corrected")
+
+// startReconciler re-syncs the PRs with GitHub right away, then every reconcile.interval (6 hours by default)
+func startReconciler(app *App) {
+	interval := app.ko.Duration("reconcile.interval")
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+	go func() {
+		for {
+			reconcilePRs(app)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// reconcilePRs re-syncs the open PRs of every repository with GitHub, correcting the drift left by
+// the webhook deliveries which were missed or could not be processed
+func reconcilePRs(app *App) {
+	repos, err := repository.Init(app.db).GetAll()
+	if err != nil {
+		app.log.Printf("Failed to fetch the repositories to reconcile - %v", err)
+		return
+	}
+
+	clients := make(map[int64]*provider.GitHub)
+	reconciled, drifted := 0, 0
+	for _, repo := range *repos {
+		g, found := clients[repo.InstallationId]
+		if !found {
+			g, err = installationClient(app, repo.InstallationId)
+			if err != nil {
+				app.log.Printf("Failed to fetch app access token while reconciling repo %s - %v", repo.Name, err)
+				continue
+			}
+			clients[repo.InstallationId] = g
+		}
+
+		drift, rErr := reconcileRepository(app, g, repo)
+		if drift == nil {
+			app.log.Printf("Failed to reconcile repo %s - %v", repo.Name, rErr)
+			continue
+		}
+		reconciled++
+		if !drift.Empty() {
+			drifted++
+			app.log.Printf("Reconciled repo %s: %s", repo.Name, drift)
+		}
+		if rErr != nil {
+			app.log.Printf("Failed to correct the drift of repo %s - %v", repo.Name, rErr)
+		}
+	}
+	app.log.Printf("Reconciled %d of %d repositories, %d had drifted from GitHub", reconciled, len(*repos), drifted)
+}
+
+// reconcileRepository records the open PRs of the repository which are missing, closes the ones which are no
+// longer open, and refreshes the stale ones. Returns the drift found, and the errors of its correction.
+func reconcileRepository(app *App, g *provider.GitHub, repo repository.RepoModel) (*reconcile.Drift, error) {
+	open := "open"
+	prs, err := g.GetPRs(repo.Owner, repo.Name, &open, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	prModel := prp.Init(app.db)
+	recorded, err := prModel.GetOpenPRs(repo.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	config := repoconfig.ForRepository(app.ko, repo.Config)
+	drift := reconcile.Compute(repo.RepoId, *recorded, prs, config.Bool("bot.ignore_bot_prs"))
+
+	// Most of the PRs share the same base branch, fetch its protection only once
+	protectedBranches := make(map[string]bool)
+	lifeTime := func(pr *github.PullRequest) int {
+		base := pr.GetBase().GetRef()
+		protected, fetched := protectedBranches[base]
+		if !fetched && len(base) > 0 {
+			protected = isBranchProtected(app, g, repo.Owner, repo.Name, base)
+			protectedBranches[base] = protected
+		}
+		// The PRs are listed without their size
+		return estimateLifeTime(app, withSize(app, g, repo.Owner, repo.Name, pr), repo.RepoId, repo.Owner+"/"+repo.Name, protected)
+	}
+
+	var errs error
+	for _, pr := range drift.Missing {
+		// A PR recorded as closed (e.g. its reopened event was missed) is replaced
+		if uErr := prModel.Upsert(prp.CreateDataModelForPR(*pr, repo.RepoId, lifeTime(pr))); uErr != nil {
+			errs = errors.Join(errs, fmt.Errorf("PR %d - %w", pr.GetNumber(), uErr))
+			continue
+		}
+		driftCorrected.Add(reconcile.DriftMissing, 1)
+	}
+	for _, closed := range drift.Closed {
+		// Only closed once GitHub confirms it, a failure to fetch the PR must not close an open PR
+		actual, gErr := g.GetPrById(closed.Number, repo.Owner, repo.Name)
+		if gErr != nil {
+			errs = errors.Join(errs, fmt.Errorf("PR %d - %w", closed.Number, gErr))
+			continue
+		}
+		if actual.GetState() == "open" {
+			// Opened again since the PRs were listed
+			continue
+		}
+		toUpdate := map[string]interface{}{
+			"status":        actual.GetState(),
+			"pr_updated_at": actual.GetUpdatedAt().Unix(),
+		}
+		if uErr := prModel.UpdateByPRId(closed.PRID, toUpdate); uErr != nil {
+			errs = errors.Join(errs, fmt.Errorf("PR %d - %w", closed.Number, uErr))
+			continue
+		}
+		driftCorrected.Add(reconcile.DriftClosed, 1)
+	}
+	for _, change := range drift.Changed {
+		if uErr := prModel.UpdateByPRId(change.PR.GetID(), change.Fields); uErr != nil {
+			errs = errors.Join(errs, fmt.Errorf("PR %d - %w", change.PR.GetNumber(), uErr))
+			continue
+		}
+		driftCorrected.Add(reconcile.DriftChanged, 1)
+	}
+	return &drift, errs
+}
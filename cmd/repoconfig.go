@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"nudge/internal/database/repository"
+	provider "nudge/internal/provider/github"
+	"nudge/repoconfig"
+	"strings"
+)
+
+// repoConfigCheckName is the name of the check run reporting the validation of the configuration file
+const repoConfigCheckName = "Nudge configuration"
+
+// syncRepoConfigs fetches the configuration file of every monitored repository from its default branch
+func syncRepoConfigs(app *App) {
+	repos, err := repository.Init(app.db).GetAll()
+	if err != nil {
+		app.log.Printf("Failed to fetch the repositories to sync their configuration %v", err)
+		return
+	}
+	clients := make(map[int64]*provider.GitHub)
+	for _, repo := range *repos {
+		g, found := clients[repo.InstallationId]
+		if !found {
+			g, err = installationClient(app, repo.InstallationId)
+			if err != nil {
+				app.log.Printf("Failed to fetch app access token for installation %d while syncing the configuration - %v", repo.InstallationId, err)
+			}
+			clients[repo.InstallationId] = g
+		}
+		if g != nil {
+			fetchRepoConfig(app, g, repo.Owner, repo.Name, repo.RepoId)
+		}
+	}
+}
+
+// fetchRepoConfig fetches the configuration file from the default branch of the repository and caches it.
+// An invalid configuration file is not cached, and the configuration cached earlier stays in effect.
+// Returns the configuration file, or nil if it could not be fetched or is invalid.
+func fetchRepoConfig(app *App, g *provider.GitHub, owner, repoName string, repoId int64) *string {
+	content, err := g.GetFileContent(owner, repoName, repoconfig.Path, "")
+	if err != nil {
+		if !provider.IsNotFound(err) {
+			app.log.Printf("Failed to fetch %s of repo %s - %v", repoconfig.Path, repoName, err)
+			return nil
+		}
+		// The repository has no configuration file, the global configuration applies
+		content = ""
+	}
+
+	config := &content
+	if _, errs := repoconfig.Parse(content); len(errs) > 0 {
+		app.log.Printf("Ignoring the invalid %s of repo %s - %s", repoconfig.Path, repoName, validationErrorList(errs, "; "))
+		config = nil
+	}
+	if uErr := repository.Init(app.db).UpdateConfig(repoId, config); uErr != nil {
+		app.log.Printf("Failed to cache the configuration of repo %s - %v", repoName, uErr)
+	}
+	return config
+}
+
+// handlePush validates the configuration file changed by the push, and reports the problems on the head
+// commit as a check run. The configuration is cached when it is pushed to the default branch. The check run is
+// reported last, since a failure before it is retried.
+func handlePush(push github.PushEvent, app *App) error {
+	if push.Installation == nil || push.GetDeleted() || !touchesRepoConfig(push) {
+		return nil
+	}
+	repo := push.GetRepo()
+	owner := repo.GetOwner().GetLogin()
+	if len(owner) == 0 {
+		owner = repo.GetOwner().GetName()
+	}
+	g, err := installationClient(app, push.Installation.GetID())
+	if err != nil {
+		return fmt.Errorf("failed to fetch app access token while validating the configuration of repo %s - %w", repo.GetName(), err)
+	}
+
+	onDefaultBranch := push.GetRef() == "refs/heads/"+repo.GetDefaultBranch()
+	content, err := g.GetFileContent(owner, repo.GetName(), repoconfig.Path, push.GetAfter())
+	if err != nil {
+		if !provider.IsNotFound(err) {
+			return fmt.Errorf("failed to fetch %s of repo %s at %s - %w", repoconfig.Path, repo.GetName(), push.GetAfter(), err)
+		}
+		// The configuration file has been removed, the global configuration applies
+		if onDefaultBranch {
+			removed := ""
+			if uErr := repository.Init(app.db).UpdateConfig(repo.GetID(), &removed); uErr != nil {
+				return fmt.Errorf("failed to cache the configuration of repo %s - %w", repo.GetName(), uErr)
+			}
+		}
+		return nil
+	}
+
+	_, errs := repoconfig.Parse(content)
+	if onDefaultBranch && len(errs) == 0 {
+		if uErr := repository.Init(app.db).UpdateConfig(repo.GetID(), &content); uErr != nil {
+			return fmt.Errorf("failed to cache the configuration of repo %s - %w", repo.GetName(), uErr)
+		}
+	}
+
+	conclusion, title, summary := "success", "The configuration is valid", fmt.Sprintf("The settings of `%s` apply to this repository.", repoconfig.Path)
+	if !onDefaultBranch {
+		summary = fmt.Sprintf("The settings of `%s` apply to this repository once merged into %s.", repoconfig.Path, repo.GetDefaultBranch())
+	}
+	if len(errs) > 0 {
+		conclusion = "failure"
+		title = fmt.Sprintf("The configuration has %d error(s)", len(errs))
+		summary = fmt.Sprintf("`%s` is ignored until the following errors are fixed:\n\n%s", repoconfig.Path, validationErrorList(errs, "\n"))
+	}
+	if cErr := g.CreateCheckRun(owner, repo.GetName(), push.GetAfter(), repoConfigCheckName, conclusion, title, summary); cErr != nil {
+		app.log.Printf("Failed to report the validation of the configuration of repo %s - %v", repo.GetName(), cErr)
+	}
+	return nil
+}
+
+// touchesRepoConfig returns true if any commit of the push adds, modifies or removes the configuration file
+func touchesRepoConfig(push github.PushEvent) bool {
+	for _, commit := range push.Commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if file == repoconfig.Path {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// validationErrorList returns the validation errors as a markdown list, separated by sep
+func validationErrorList(errs []repoconfig.ValidationError, sep string) string {
+	items := make([]string, len(errs))
+	for i, e := range errs {
+		if len(e.Key) == 0 {
+			items[i] = "- " + e.Message
+		} else {
+			items[i] = fmt.Sprintf("- `%s`: %s", e.Key, e.Message)
+		}
+	}
+	return strings.Join(items, sep)
+}
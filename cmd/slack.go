@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"nudge/internal/database/user"
+	"nudge/notify"
 	"regexp"
 	"strconv"
 	"strings"
@@ -116,7 +117,6 @@ type SlackGitHubMappingCommand struct {
 	TeamDomain          string `form:"team_domain,omitempty"`
 	TeamId              string `form:"team_id"`
 	Text                string `form:"text"`
-	Token               string `form:"token"`
 	TriggerId           string `form:"trigger_id"`
 	UserId              string `form:"user_id"`
 	UserName            string `form:"user_name"`
@@ -132,6 +132,12 @@ func storeGitHubSlackMapping(c echo.Context) error {
 	if err != nil || len(request.GitHubUserName) == 0 || len(request.SlackAccessToken) == 0 {
 		return c.String(http.StatusBadRequest, "bad request")
 	}
+	// The page of the OAuth redirect cannot sign its request, the Slack user is authenticated by its access token
+	err = notify.NewSlackTokenVerifier().VerifyUser(request.SlackAccessToken, request.SlackUserId)
+	if err != nil {
+		app.log.Printf("Rejected the mapping of the Slack user %s from %s - %v", request.SlackUserId, c.RealIP(), err)
+		return c.JSON(http.StatusUnauthorized, "Please sign in with Slack again")
+	}
 
 	u := user.Init(app.db)
 	err = u.UpdateSlackConfig(request.GitHubUserName, request.SlackAccessToken, request.SlackUserId)
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	prp "nudge/internal/database/pr"
+	"nudge/internal/database/repository"
+	"nudge/internal/database/user"
+	time2 "nudge/internal/time"
+	"nudge/notify"
+	"strconv"
+	"strings"
+)
+
+// slackInteraction is the payload of the interactions with the Slack nudges (block_actions) and with the
+// modal reassigning the review (view_submission)
+// https://api.slack.com/reference/interaction-payloads
+type slackInteraction struct {
+	Type        string `json:"type"`
+	TriggerId   string `json:"trigger_id"`
+	ResponseUrl string `json:"response_url"`
+	User        struct {
+		Id string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionId string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	View struct {
+		CallbackId      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]struct {
+				Value string `json:"value"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+}
+
+// slackActor is the GitHub user, mapped to the Slack user, acting on the PR from Slack
+type slackActor struct {
+	pr             *prp.PRModel
+	repo           *repository.RepoModel
+	installation   *user.UserModel
+	githubUsername string
+}
+
+var errSlackUserNotMapped = errors.New("your Slack account is not mapped to a GitHub account. Map it with `/map-github installation-id github-username`")
+
+// handleSlackMessageAction handles the buttons of the Slack nudges, and the submission of the modal
+// reassigning the review of the PR. The Slack user is mapped back to the GitHub user of the installation.
+func handleSlackMessageAction(c echo.Context) error {
+	var (
+		app = c.Get("app").(*App)
+	)
+
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(c.FormValue("payload")), &interaction); err != nil || len(interaction.User.Id) == 0 {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	switch interaction.Type {
+	case "block_actions":
+		if len(interaction.Actions) == 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		var value notify.SlackActionValue
+		if err := json.Unmarshal([]byte(interaction.Actions[0].Value), &value); err != nil || value.PRID == 0 {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		reply := handleSlackButton(app, interaction, interaction.Actions[0].ActionId, value)
+		if len(reply) > 0 {
+			if err := notify.RespondToSlackAction(interaction.ResponseUrl, reply); err != nil {
+				app.log.Printf("Failed to respond to the Slack action %s - %v", interaction.Actions[0].ActionId, err)
+			}
+		}
+		return c.NoContent(http.StatusOK)
+	case "view_submission":
+		if interaction.View.CallbackId != notify.SlackReassignCallbackId {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		prId, err := strconv.ParseInt(interaction.View.PrivateMetadata, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		reviewer := interaction.View.State.Values[notify.SlackReassignBlockId][notify.SlackReassignActionId].Value
+		if problem := reassignReview(app, prId, interaction.User.Id, reviewer); len(problem) > 0 {
+			// Shows the problem on the input of the modal, which stays open
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"response_action": "errors",
+				"errors":          map[string]string{notify.SlackReassignBlockId: problem},
+			})
+		}
+		return c.NoContent(http.StatusOK)
+	default:
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// handleSlackButton acts on the button of the Slack nudge pressed by the user, and returns the reply to the user
+func handleSlackButton(app *App, interaction slackInteraction, actionId string, value notify.SlackActionValue) string {
+	actor, err := findSlackActor(app, value.PRID, interaction.User.Id)
+	if err != nil {
+		if errors.Is(err, errSlackUserNotMapped) {
+			return "Sorry, " + err.Error() + "."
+		}
+		app.log.Printf("Failed to find the PR %d of the Slack action %s - %v", value.PRID, actionId, err)
+		return "Sorry, the pull request could not be found. It may have been closed."
+	}
+	prs := prp.Init(app.db)
+	nudgeTime := new(time2.NudgeTime)
+	now := nudgeTime.NudgeTime()
+
+	switch {
+	case strings.HasPrefix(actionId, notify.SlackActionSnooze):
+		duration, valid := prp.ParseSnoozeDuration(value.Snooze)
+		if !valid {
+			return ""
+		}
+		until := now.Add(duration)
+		snoozedUntil := until.Unix()
+		if err = prs.UpdateSnooze(actor.pr.PRID, &snoozedUntil); err != nil {
+			app.log.Printf("Failed to snooze PR %d of repo %s from Slack - %v", actor.pr.Number, actor.repo.Name, err)
+			return "Sorry, the nudges could not be snoozed. Please try again later."
+		}
+		app.log.Printf("%s snoozed PR %d of repo %s from Slack until %d", actor.githubUsername, actor.pr.Number, actor.repo.Name, snoozedUntil)
+		return fmt.Sprintf("The nudges of PR #%d in repository *%s* are snoozed until %s.", actor.pr.Number, actor.repo.Name, until.UTC().Format("Mon, 02 Jan 2006 15:04 MST"))
+	case actionId == notify.SlackActionOnIt:
+		// Counts as an activity of the actor, which resets the clock of the PR
+		signal := prp.ActivitySignal{
+			Signal:     prp.SignalAcknowledgement,
+			Action:     "on_it",
+			Actor:      actor.githubUsername,
+			OccurredAt: now.Unix(),
+		}
+		if err = prs.RecordActivitySignal(actor.pr.PRID, signal); err == nil {
+			err = prs.UpdateByPRId(actor.pr.PRID, map[string]interface{}{
+				"workflow_last_activity":        now.Unix(),
+				"last_workflow_action_recorded": signal.Action,
+			})
+		}
+		if err != nil {
+			app.log.Printf("Failed to record the acknowledgement of PR %d of repo %s from Slack - %v", actor.pr.Number, actor.repo.Name, err)
+			return "Sorry, your acknowledgement could not be recorded. Please try again later."
+		}
+		return fmt.Sprintf("Thanks! The clock of PR #%d in repository *%s* has been reset.", actor.pr.Number, actor.repo.Name)
+	case actionId == notify.SlackActionReassign:
+		if !isRequestedReviewer(*actor.pr, actor.githubUsername) {
+			return fmt.Sprintf("You are not a requested reviewer of PR #%d in repository *%s*.", actor.pr.Number, actor.repo.Name)
+		}
+		view := notify.CreateSlackReassignView(actor.pr.PRID, actor.pr.Number, actor.repo.Name)
+		if err = notify.OpenSlackView(*actor.installation.SlackAccessToken, interaction.TriggerId, view); err != nil {
+			app.log.Printf("Failed to open the Slack view to reassign the review of PR %d - %v", actor.pr.Number, err)
+			return "Sorry, the review could not be reassigned. Please try again later."
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+// reassignReview requests the review of the PR from the reviewer (GitHub username) in place of the GitHub
+// user mapped to the Slack user. Returns the problem to show to the Slack user, if the review could not be
+// reassigned.
+func reassignReview(app *App, prId int64, slackUserId, reviewer string) string {
+	actor, err := findSlackActor(app, prId, slackUserId)
+	if err != nil {
+		if errors.Is(err, errSlackUserNotMapped) {
+			return "Your Slack account is not mapped to a GitHub account."
+		}
+		app.log.Printf("Failed to find the PR %d to reassign its review - %v", prId, err)
+		return "The pull request could not be found."
+	}
+	reviewer = strings.TrimPrefix(strings.TrimSpace(reviewer), "@")
+	if len(reviewer) == 0 {
+		return "Enter the GitHub username of the new reviewer."
+	}
+	if strings.EqualFold(reviewer, actor.githubUsername) || (actor.pr.Author != nil && strings.EqualFold(reviewer, *actor.pr.Author)) {
+		return "Enter the GitHub username of someone other than you and the author of the pull request."
+	}
+
+	g, err := installationClient(app, actor.repo.InstallationId)
+	if err != nil {
+		app.log.Printf("Failed to fetch app access token while reassigning the review of PR %d - %v", actor.pr.Number, err)
+		return "The review could not be reassigned. Please try again later."
+	}
+	if err = g.RequestReviewers(actor.repo.Owner, actor.repo.Name, actor.pr.Number, []string{reviewer}); err != nil {
+		app.log.Printf("Failed to request the review of PR %d of repo %s from %s - %v", actor.pr.Number, actor.repo.Name, reviewer, err)
+		return fmt.Sprintf("The review could not be requested from %s. Check that they are a collaborator of the repository.", reviewer)
+	}
+	// The review requests are recorded on the PR by their webhook events
+	if err = g.RemoveReviewers(actor.repo.Owner, actor.repo.Name, actor.pr.Number, []string{actor.githubUsername}); err != nil {
+		app.log.Printf("Failed to remove the review request of PR %d of repo %s from %s - %v", actor.pr.Number, actor.repo.Name, actor.githubUsername, err)
+	}
+	app.log.Printf("%s reassigned the review of PR %d of repo %s to %s from Slack", actor.githubUsername, actor.pr.Number, actor.repo.Name, reviewer)
+	return ""
+}
+
+// findSlackActor returns the PR and the GitHub user mapped to the Slack user in the installation of the repository
+func findSlackActor(app *App, prId int64, slackUserId string) (*slackActor, error) {
+	pr, err := prp.Init(app.db).FindByPRId(prId)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := repository.Init(app.db).FindByRepoId(pr.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	installation, err := user.Init(app.db).FindSlackUserIdFromInstallationId(repo.InstallationId)
+	if err != nil {
+		return nil, err
+	}
+	githubUsername, mapped := installation.GitHubUsernameOf(slackUserId)
+	if !mapped || installation.SlackAccessToken == nil {
+		return nil, errSlackUserNotMapped
+	}
+	return &slackActor{
+		pr:             pr,
+		repo:           repo,
+		installation:   installation,
+		githubUsername: githubUsername,
+	}, nil
+}
+
+// isRequestedReviewer returns true if the review of the PR is requested from the GitHub user
+func isRequestedReviewer(pr prp.PRModel, githubUsername string) bool {
+	if pr.RequestedReviewers == nil {
+		return false
+	}
+	for _, reviewer := range *pr.RequestedReviewers {
+		if strings.EqualFold(reviewer, githubUsername) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/google/go-github/v52/github"
+	"nudge/internal/database/lifetime"
+	"nudge/internal/database/outcome"
+	"nudge/internal/database/repository"
+	provider "nudge/internal/provider/github"
+	"nudge/prediction"
+)
+
+// trainLifetimeModels backfills the outcomes of the merged PRs of every monitored repository
+// and fits the lifetime model of each repository which has enough merged PRs. The fitted
+// models are used at runtime by the "trained" prediction strategy.
+func trainLifetimeModels(app *App) {
+	repoList, err := repository.Init(app.db).GetAll()
+	if err != nil {
+		app.log.Printf("Failed to fetch the repositories to train %v", err)
+		return
+	}
+
+	minSamples := app.ko.Int("train.min_samples")
+	trained := 0
+	for _, repo := range *repoList {
+		g, gErr := installationClient(app, repo.InstallationId)
+		if gErr != nil {
+			app.log.Printf("Failed to fetch app access token for repository %s %v", repo.Name, gErr)
+			continue
+		}
+
+		backfillPROutcomes(app, g, repo)
+
+		outcomes, oErr := outcome.Init(app.db).GetAll(repo.RepoId)
+		if oErr != nil {
+			app.log.Printf("Failed to read the PR outcomes of repository %s %v", repo.Name, oErr)
+			continue
+		}
+		coefficients, fitErr := prediction.Fit(outcome.TrainingSamples(outcomes), minSamples)
+		if fitErr != nil {
+			app.log.Printf("Skipping the lifetime model for repository %s (%d merged PRs) - %v", repo.Name, len(outcomes), fitErr)
+			continue
+		}
+		if uErr := lifetime.Init(app.db).Upsert(repo.RepoId, *coefficients, len(outcomes)); uErr != nil {
+			app.log.Printf("Failed to store the lifetime model of repository %s %v", repo.Name, uErr)
+			continue
+		}
+		trained++
+		app.log.Printf("Trained the lifetime model of repository %s from %d merged PRs", repo.Name, len(outcomes))
+	}
+
+	app.log.Printf("Trained the lifetime models of %d out of %d repositories", trained, len(*repoList))
+}
+
+// backfillPROutcomes records the outcomes of the merged PRs of the repository which have not been
+// recorded yet. At most train.max_prs (0 for all) of the most recent merged PRs are backfilled.
+func backfillPROutcomes(app *App, g *provider.GitHub, repo repository.RepoModel) {
+	state := "closed"
+	prs, prErr := g.GetPRs(repo.Owner, repo.Name, &state, app.ko.Int("train.max_prs"), func(pr *github.PullRequest) bool {
+		return pr.MergedAt != nil
+	})
+	if prErr != nil {
+		app.log.Printf("Failed to fetch the merged PRs of repository %s %v", repo.Name, prErr)
+		return
+	}
+
+	o := outcome.Init(app.db)
+	recorded, rErr := o.GetPRIds(repo.RepoId)
+	if rErr != nil {
+		app.log.Printf("Failed to read the PR outcomes of repository %s %v", repo.Name, rErr)
+		return
+	}
+
+	outcomes := make([]*outcome.OutcomeModel, 0)
+	for _, pr := range prs {
+		if recorded[pr.GetID()] {
+			continue
+		}
+
+		// The list API does not return the size of the PR
+		details, dErr := g.GetPrById(pr.GetNumber(), repo.Owner, repo.Name)
+		if dErr != nil {
+			app.log.Printf("Failed to fetch PR#%d of repository %s %v", pr.GetNumber(), repo.Name, dErr)
+			continue
+		}
+		reviews, reviewErr := g.GetPRReviews(repo.Owner, repo.Name, pr.GetNumber())
+		if reviewErr != nil {
+			app.log.Printf("Failed to fetch the reviews of PR#%d of repository %s %v", pr.GetNumber(), repo.Name, reviewErr)
+			continue
+		}
+		outcomes = append(outcomes, outcome.CreateDataModelForOutcome(*details, repo.RepoId, reviews))
+	}
+
+	if err := o.BulkUpsert(outcomes); err != nil {
+		app.log.Printf("Failed to store the PR outcomes of repository %s %v", repo.Name, err)
+		return
+	}
+	app.log.Printf("Backfilled %d merged PRs of repository %s", len(outcomes), repo.Name)
+}
@@ -1,90 +1,154 @@
 package main
 
 import (
+	"errors"
+	"expvar"
+	"fmt"
 	"github.com/google/go-github/v52/github"
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
+	"nudge/actor"
 	prp "nudge/internal/database/pr"
 	"nudge/internal/database/repository"
 	uc "nudge/internal/database/user"
+	"nudge/internal/database/webhook"
 	provider "nudge/internal/provider/github"
+	time2 "nudge/internal/time"
+	"strings"
 )
 
+// webhookRejections counts the webhook deliveries rejected by their signature, by reason
+var webhookRejections = expvar.NewMap("github_webhook_rejections")
+
 func handleWebhook(c echo.Context) error {
 	var (
 		app = c.Get("app").(*App)
 	)
 	app.log.Println("Received webhook")
 
-	payload, err := github.ValidatePayload(c.Request(), nil)
-	if err != nil {
-		return err
+	// github.webhook_previous_secret stays active while github.webhook_secret is being rotated
+	secrets := [][]byte{
+		[]byte(app.ko.String("github.webhook_secret")),
+		[]byte(app.ko.String("github.webhook_previous_secret")),
 	}
-	event, err := github.ParseWebHook(github.WebHookType(c.Request()), payload)
+	payload, err := provider.ValidateWebhook(c.Request(), secrets)
 	if err != nil {
-		return err
+		var reason string
+		switch {
+		case errors.Is(err, provider.ErrWebhookSecretMissing):
+			reason = "secret_missing"
+		case errors.Is(err, provider.ErrWebhookUnsigned):
+			reason = "unsigned"
+		case errors.Is(err, provider.ErrWebhookSignature):
+			reason = "invalid_signature"
+		default:
+			// Unreadable body or unsupported content type
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		webhookRejections.Add(reason, 1)
+		app.log.Printf("Rejected the webhook delivery %s (%s) from %s - %v", github.DeliveryID(c.Request()),
+			github.WebHookType(c.Request()), c.RealIP(), err)
+		return c.String(http.StatusUnauthorized, "unauthorized")
+	}
+	eventType := github.WebHookType(c.Request())
+	if _, err = github.ParseWebHook(eventType, payload); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
 	}
 
-	go func() {
-		switch event := event.(type) {
-		case *github.PullRequestEvent:
-			handlePR(*event, app)
-			break
-		case *github.PullRequestReviewThreadEvent:
-			updateWorkflow(*event, app)
-			resolveReview(*event, app)
-			break
-		case *github.PullRequestReviewEvent:
-			// https://docs.github.com/en/graphql/reference/enums#pullrequestreviewevent
-			updateWorkflow(*event, app)
-			addReview(*event, app)
-			break
-		case *github.PullRequestReviewCommentEvent:
-			break
-		case *github.InstallationEvent:
-			uninstallApp(*event, app)
-			break
-		case *github.InstallationRepositoriesEvent:
-			handleInstallRepositoryEvent(*event, app)
-			break
-		}
-	}() // Process the webhook in a separate coroutine
+	// The delivery is persisted before it is acknowledged, and processed by the webhook workers
+	deliveryId := github.DeliveryID(c.Request())
+	if len(deliveryId) == 0 {
+		return c.String(http.StatusBadRequest, "missing X-GitHub-Delivery")
+	}
+	q := webhook.Init(app.db)
+	if processed, pErr := q.IsProcessed(deliveryId); pErr == nil && processed {
+		app.log.Printf("Skipping the webhook delivery %s (%s), already processed", deliveryId, eventType)
+		return c.JSON(http.StatusOK, okResp{"out"})
+	}
+	if err = q.Enqueue(deliveryId, eventType, payload); err != nil {
+		app.log.Printf("Failed to queue the webhook delivery %s (%s) - %v", deliveryId, eventType, err)
+		return c.String(http.StatusInternalServerError, "failed to queue the delivery")
+	}
+	notifyWebhookWorkers()
 
 	return c.JSON(http.StatusOK, okResp{"out"})
 }
 
-func handlePR(pr github.PullRequestEvent, app *App) {
+// processWebhookEvent updates the PR model with the webhook event (of the delivery). The errors of the updates are
+// returned, for the delivery to be retried, so the updates are idempotent. The activity signal of a PR event is
+// recorded once the PR is updated, since the PR of an opened event is only created by its handler. The signal of
+// the other events is recorded first: the handlers with side effects outside Nudge (e.g. replying to a command) only
+// run once it is recorded, and do not fail the delivery, since they must not be repeated.
+func processWebhookEvent(deliveryId string, event interface{}, app *App) error {
+	if event, ok := event.(*github.PullRequestEvent); ok {
+		if err := handlePR(*event, app); err != nil {
+			return err
+		}
+		return recordActivitySignal(deliveryId, event, app)
+	}
+	if err := recordActivitySignal(deliveryId, event, app); err != nil {
+		return err
+	}
+	switch event := event.(type) {
+	case *github.PullRequestReviewThreadEvent:
+		return errors.Join(updateWorkflow(*event, app), updateReviewThread(*event, app))
+	case *github.PullRequestReviewEvent:
+		// https://docs.github.com/en/graphql/reference/enums#pullrequestreviewevent
+		return errors.Join(updateWorkflow(*event, app), addReview(*event, app))
+	case *github.PullRequestReviewCommentEvent:
+		return recordReviewComment(*event, app)
+	case *github.IssueCommentEvent:
+		handleIssueComment(*event, app)
+	case *github.CheckSuiteEvent:
+		return handleCheckSuite(*event, app)
+	case *github.CheckRunEvent:
+		return handleCheckRun(*event, app)
+	case *github.StatusEvent:
+		return handleStatus(*event, app)
+	case *github.PushEvent:
+		return handlePush(*event, app)
+	case *github.InstallationEvent:
+		return uninstallApp(*event, app)
+	case *github.InstallationRepositoriesEvent:
+		return handleInstallRepositoryEvent(*event, app)
+	}
+	return nil
+}
+
+func handlePR(pr github.PullRequestEvent, app *App) error {
 	if pr.Action != nil {
 		switch *pr.Action {
 		case "opened":
-			handleNewPRRequest(pr, app)
-			break
+			return handleNewPRRequest(pr, app)
 		case "closed":
-			handlePRCloseRequest(pr, app)
-			updateWorkflow(pr, app)
-			break
-		case "reopened":
-		case "ready_for_review":
-			handlePRReopenRequest(pr, app)
-			updateWorkflow(pr, app)
-			break
+			err := errors.Join(handlePRCloseRequest(pr, app), updateWorkflow(pr, app))
+			recordPROutcome(pr, app)
+			return err
+		case "reopened", "ready_for_review":
+			return errors.Join(handlePRReopenRequest(pr, reviseLifeTime(pr, app), app), updateWorkflow(pr, app))
+		case "converted_to_draft":
+			return errors.Join(updateDraft(pr, app), updateWorkflow(pr, app))
 		case "synchronize":
-			updateWorkflow(pr, app)
-			break
+			err := errors.Join(updateWorkflow(pr, app), dismissStaleApprovals(pr, app), resetCI(pr, app))
+			reviseLifeTime(pr, app)
+			return err
 		case "review_requested":
-			updateWorkflow(pr, app)
-			updateReviewers(pr, app)
-			break
+			return errors.Join(updateWorkflow(pr, app), updateReviewers(pr, app))
 		case "review_request_removed":
-			updateReviewers(pr, app)
-			break
+			return updateReviewers(pr, app)
 		case "edited":
-			break
+			err := updateTitle(pr, app)
+			reviseLifeTime(pr, app)
+			return err
+		case "labeled", "unlabeled":
+			return updateLabels(pr, app)
 		}
 	}
+	return nil
 }
 
-func updateWorkflow(pr interface{}, app *App) {
+func updateWorkflow(pr interface{}, app *App) error {
 	var (
 		workflowLastActivity               int64
 		workflowLastActionRecorded         string
@@ -124,21 +188,124 @@ func updateWorkflow(pr interface{}, app *App) {
 	})
 
 	if err != nil {
-		app.log.Printf("Error while updating the workflow on PullRequestReviewThreadEvent %v", err)
+		return fmt.Errorf("error while updating the workflow of PR %d - %w", prId, err)
+	}
+	return nil
+}
+
+// stateChangeActions are the pull request actions which change the state of the PR
+var stateChangeActions = map[string]bool{
+	"opened":                 true,
+	"closed":                 true,
+	"reopened":               true,
+	"ready_for_review":       true,
+	"converted_to_draft":     true,
+	"review_requested":       true,
+	"review_request_removed": true,
+	"edited":                 true,
+}
+
+// recordActivitySignal records the activity signal carried by the webhook event (of the delivery) on the PR. The
+// comments made by Nudge itself are not recorded, since they must never count as an activity.
+func recordActivitySignal(deliveryId string, event interface{}, app *App) error {
+	var (
+		prId       int64
+		signal     prp.ActivitySignal
+		sender     *github.User
+		occurredAt github.Timestamp
+	)
+
+	switch event := event.(type) {
+	case *github.PullRequestEvent:
+		if event.GetAction() == "synchronize" {
+			signal.Signal = prp.SignalCommit
+		} else if stateChangeActions[event.GetAction()] {
+			signal.Signal = prp.SignalStateChange
+		} else {
+			return nil
+		}
+		prId, signal.Action, sender = event.GetPullRequest().GetID(), event.GetAction(), event.Sender
+		occurredAt = event.GetPullRequest().GetUpdatedAt()
+	case *github.PullRequestReviewEvent:
+		signal.Signal = prp.SignalReview
+		prId, signal.Action, sender = event.GetPullRequest().GetID(), event.GetAction(), event.Sender
+		occurredAt = event.GetReview().GetSubmittedAt()
+	case *github.PullRequestReviewThreadEvent:
+		signal.Signal = prp.SignalThreadStatus
+		prId, signal.Action, sender = event.GetPullRequest().GetID(), event.GetAction(), event.Sender
+		// The thread carries no timestamp of its own, it was resolved or unresolved with its last update
+		if comments := event.GetThread().Comments; len(comments) > 0 {
+			occurredAt = comments[len(comments)-1].GetUpdatedAt()
+		}
+	case *github.PullRequestReviewCommentEvent:
+		signal.Signal = prp.SignalComment
+		prId, signal.Action, sender = event.GetPullRequest().GetID(), event.GetAction(), event.Sender
+		occurredAt = event.GetComment().GetCreatedAt()
+	case *github.IssueCommentEvent:
+		if !event.GetIssue().IsPullRequest() {
+			return nil
+		}
+		// The issue comment events do not carry the id of the PR
+		pr, err := prp.Init(app.db).FindByNumber(event.GetRepo().GetID(), event.GetIssue().GetNumber())
+		if err != nil {
+			// The PR is not monitored
+			return nil
+		}
+		signal.Signal = prp.SignalComment
+		prId, signal.Action, sender = pr.PRID, event.GetAction(), event.Sender
+		occurredAt = event.GetComment().GetCreatedAt()
+	default:
+		return nil
+	}
+
+	if sender == nil || prId == 0 || isNudgeBot(sender.GetLogin(), app) {
+		return nil
+	}
+
+	signal.Actor = sender.GetLogin()
+	signal.IsBot = strings.ToLower(sender.GetType()) == "bot"
+	// The activity occurred when GitHub says it did, not when the (possibly retried) delivery is processed
+	signal.OccurredAt = occurredAt.Unix()
+	if occurredAt.IsZero() {
+		signal.OccurredAt = new(time2.NudgeTime).NudgeTime().Unix()
+	}
+	signal.DeliveryId = deliveryId
+	err := prp.Init(app.db).RecordActivitySignal(prId, signal)
+	if err != nil {
+		return fmt.Errorf("failed to record the %s activity signal for PR %d - %w", signal.Signal, prId, err)
 	}
+	return nil
+}
 
+// isNudgeBot returns true if the login belongs to the bot user of the Nudge GitHub app, i.e. github.bot_username or
+// the <slug>[bot] login of the app. If the login of the app cannot be fetched, every bot login is assumed to be Nudge.
+func isNudgeBot(login string, app *App) bool {
+	botUsername := app.ko.String("github.bot_username")
+	if len(botUsername) > 0 && strings.EqualFold(login, botUsername) {
+		return true
+	}
+	if !strings.HasSuffix(strings.ToLower(login), "[bot]") {
+		return false
+	}
+	appLogin, err := appTokens(app).BotLogin()
+	if err != nil {
+		app.log.Printf("Failed to fetch the login of the app, treating %s as Nudge - %v", login, err)
+		return true
+	}
+	return strings.EqualFold(login, appLogin)
 }
 
-func handleNewPRRequest(pr github.PullRequestEvent, app *App) {
+func handleNewPRRequest(pr github.PullRequestEvent, app *App) error {
 	prModel := prp.Init(app.db)
-	model := prp.CreateDataModelForPR(*pr.PullRequest, *pr.Repo.ID)
+	model := prp.CreateDataModelForPR(*pr.PullRequest, *pr.Repo.ID, estimateLifeTimeForEvent(pr, app))
 	err := prModel.Create(model)
 	if err != nil {
-		app.log.Printf("Error while inserting a new PR record %v", err)
+		return fmt.Errorf("error while inserting a new PR record - %w", err)
 	}
+	return nil
 }
 
-func handlePRCloseRequest(pr github.PullRequestEvent, app *App) {
+func handlePRCloseRequest(pr github.PullRequestEvent, app *App) error {
 	prModel := prp.Init(app.db)
 	err := prModel.UpdateByPRId(*pr.PullRequest.ID, map[string]interface{}{
 		"status":        *pr.PullRequest.State,
@@ -146,35 +313,126 @@ func handlePRCloseRequest(pr github.PullRequestEvent, app *App) {
 		//TODO: Better way to know the json name of the field in PRModel struct
 	})
 	if err != nil {
-		app.log.Printf("Error while updating the PR status to closed %v", err)
+		return fmt.Errorf("error while updating the PR status to closed - %w", err)
 	}
+	return nil
 }
 
-func handlePRReopenRequest(pr github.PullRequestEvent, app *App) {
+func handlePRReopenRequest(pr github.PullRequestEvent, lifeTime int, app *App) error {
 	prModel := prp.Init(app.db)
-	model := prp.CreateDataModelForPR(*pr.PullRequest, *pr.Repo.ID)
+	model := prp.CreateDataModelForPR(*pr.PullRequest, *pr.Repo.ID, lifeTime)
 	err := prModel.Upsert(model)
 	if err != nil {
-		app.log.Printf("Error while carrying out the upsert operation for PR-Reopen event %v", err)
+		return fmt.Errorf("error while carrying out the upsert operation for PR-Reopen event - %w", err)
 	}
+	return nil
 }
 
-func updateReviewers(pr github.PullRequestEvent, app *App) {
+// estimateLifeTimeForEvent predicts the lifetime of the pull request received in the webhook event
+func estimateLifeTimeForEvent(pr github.PullRequestEvent, app *App) int {
+	protectedBase := false
+	if pr.Installation != nil && pr.PullRequest.Base != nil && pr.PullRequest.Base.Ref != nil {
+		g, err := installationClient(app, *pr.Installation.ID)
+		if err != nil {
+			app.log.Printf("Failed to fetch app access token while estimating the lifetime of PR %d - %v", *pr.Number, err)
+		} else {
+			protectedBase = isBranchProtected(app, g, *pr.Repo.Owner.Login, *pr.Repo.Name, *pr.PullRequest.Base.Ref)
+		}
+	}
+	return estimateLifeTime(app, *pr.PullRequest, *pr.Repo.ID, pr.Repo.GetFullName(), protectedBase)
+}
+func updateReviewers(pr github.PullRequestEvent, app *App) error {
+	prModel := prp.Init(app.db)
+	removeReviewer := false
+	if *pr.Action == "review_request_removed" {
+		removeReviewer = true
+	}
 	if pr.RequestedReviewer != nil {
-		prModel := prp.Init(app.db)
 		reviewer := *pr.RequestedReviewer.Login
-		removeReviewer := false
-		if *pr.Action == "review_request_removed" {
-			removeReviewer = true
-		}
 		err := prModel.UpdateReviewer(*pr.PullRequest.ID, reviewer, removeReviewer)
 		if err != nil {
-			lo.Printf("Failed to update reviewers for PR %d of repo %s - %v", *pr.Number, *pr.Repo.Name, err)
+			return fmt.Errorf("failed to update reviewers for PR %d of repo %s - %w", *pr.Number, *pr.Repo.Name, err)
+		}
+		// A reviewer who already reviewed the PR and is requested again is yet to review it again. The PR
+		// is updated by the request, so its update time is the time of the request.
+		if removeReviewer {
+			err = prModel.RemoveReviewRequest(*pr.PullRequest.ID, reviewer)
+		} else {
+			err = prModel.RecordReviewRequest(*pr.PullRequest.ID, reviewer, pr.GetPullRequest().GetUpdatedAt().Unix())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update the review request of %s for PR %d of repo %s - %w", reviewer, *pr.Number, *pr.Repo.Name, err)
+		}
+	}
+	if pr.RequestedTeam != nil {
+		team := prp.TeamHandle(pr.GetRepo().GetOwner().GetLogin(), pr.RequestedTeam)
+		err := prModel.UpdateTeamReviewer(*pr.PullRequest.ID, team, removeReviewer)
+		if err != nil {
+			return fmt.Errorf("failed to update team reviewers for PR %d of repo %s - %w", *pr.Number, *pr.Repo.Name, err)
 		}
 	}
+	return nil
 }
 
-func addReview(pr github.PullRequestReviewEvent, app *App) {
+// updateLabels adds (or removes) the label of the PR. A snooze label (e.g. nudge-snooze-3d) snoozes the
+// nudges of the PR from the moment it is added, and removing it ends the snooze.
+func updateLabels(pr github.PullRequestEvent, app *App) error {
+	if pr.Label == nil || pr.Label.Name == nil {
+		return nil
+	}
+	prModel := prp.Init(app.db)
+	label := *pr.Label.Name
+	removeLabel := *pr.Action == "unlabeled"
+	err := prModel.UpdateLabel(*pr.PullRequest.ID, label, removeLabel)
+	if err != nil {
+		return fmt.Errorf("failed to update labels for PR %d of repo %s - %w", *pr.Number, *pr.Repo.Name, err)
+	}
+
+	duration, snooze := prp.SnoozeDuration(label)
+	if !snooze {
+		return nil
+	}
+	var until *int64
+	if !removeLabel {
+		nudgeTime := new(time2.NudgeTime)
+		snoozedUntil := nudgeTime.NudgeTime().Add(duration).Unix()
+		until = &snoozedUntil
+	}
+	if sErr := prModel.UpdateSnooze(*pr.PullRequest.ID, until); sErr != nil {
+		return fmt.Errorf("failed to update the snooze of PR %d of repo %s - %w", *pr.Number, *pr.Repo.Name, sErr)
+	}
+	return nil
+}
+
+// updateDraft records the PR converted to a draft, which is not nudged until it is ready for review
+func updateDraft(pr github.PullRequestEvent, app *App) error {
+	err := prp.Init(app.db).UpdateByPRId(*pr.PullRequest.ID, map[string]interface{}{
+		"draft":         true,
+		"pr_updated_at": pr.PullRequest.UpdatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to convert PR %d of repo %s to a draft - %w", *pr.Number, *pr.Repo.Name, err)
+	}
+	return nil
+}
+
+// updateTitle records the title of the edited PR
+func updateTitle(pr github.PullRequestEvent, app *App) error {
+	if pr.Changes == nil || pr.Changes.Title == nil {
+		return nil
+	}
+	err := prp.Init(app.db).UpdateByPRId(*pr.PullRequest.ID, map[string]interface{}{
+		"title": pr.PullRequest.GetTitle(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the title of PR %d of repo %s - %w", *pr.Number, *pr.Repo.Name, err)
+	}
+	return nil
+}
+
+// addReview records the submitted (or edited) review. A dismissed review replaces the review recorded with the
+// same id, so that it no longer counts as an approval or a request for changes.
+func addReview(pr github.PullRequestReviewEvent, app *App) error {
 	prModel := prp.Init(app.db)
 	submittedAt := pr.Review.SubmittedAt.Unix()
 	review := prp.Review{
@@ -183,48 +441,119 @@ func addReview(pr github.PullRequestReviewEvent, app *App) {
 		Reviewer:    pr.Review.User.Login,
 		SubmittedAt: &submittedAt,
 	}
+	if pr.GetAction() == "dismissed" {
+		dismissed := prp.ReviewStateDismissed
+		review.ReviewState = &dismissed
+	}
 	err := prModel.UpdateReview(*pr.PullRequest.ID, review, false)
 	if err != nil {
-		lo.Printf("Failed to update review for PR %d of repo %s - %v", *pr.PullRequest.Number, *pr.Repo.Name, err)
+		return fmt.Errorf("failed to update review for PR %d of repo %s - %w", *pr.PullRequest.Number, *pr.Repo.Name, err)
 	}
+	return nil
 }
 
-func resolveReview(pr github.PullRequestReviewThreadEvent, app *App) {
-	if *pr.Action == "resolved" {
-		prModel := prp.Init(app.db)
-		if pr.Thread != nil {
-			review := prp.Review{ReviewId: *pr.Thread.Comments[0].PullRequestReviewID}
-			err := prModel.UpdateReview(*pr.PullRequest.ID, review, true)
-			if err != nil {
-				lo.Printf("Failed to remove review for PR %d of repo %s - %v", *pr.PullRequest.Number, *pr.Repo.Name, err)
-			}
-		}
+// dismissStaleApprovals dismisses the approvals submitted before the push when the base branch of the PR dismisses
+// the stale approvals, so that the reviewers block the PR again until they approve the new commits
+func dismissStaleApprovals(pr github.PullRequestEvent, app *App) error {
+	if pr.Installation == nil {
+		return nil
+	}
+	g, err := installationClient(app, pr.GetInstallation().GetID())
+	if err != nil {
+		return fmt.Errorf("failed to fetch app access token while checking the stale approvals of PR %d - %w", pr.GetNumber(), err)
 	}
+	owner, repoName := pr.GetRepo().GetOwner().GetLogin(), pr.GetRepo().GetName()
+	requirements, err := actor.FetchReviewRequirements(g, owner, repoName, pr.GetPullRequest().GetBase().GetRef())
+	if err != nil {
+		return fmt.Errorf("failed to fetch the review requirements of PR %d of repo %s - %w", pr.GetNumber(), repoName, err)
+	}
+	if !requirements.DismissStaleReviews {
+		return nil
+	}
+	// The PR is updated by the push, so its update time is the time of the push
+	dismissed, err := prp.Init(app.db).DismissStaleApprovals(pr.GetPullRequest().GetID(), pr.GetPullRequest().GetUpdatedAt().Unix())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The PR is not recorded, e.g. the PR of a bot
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dismiss the stale approvals of PR %d of repo %s - %w", pr.GetNumber(), repoName, err)
+	}
+	if dismissed > 0 {
+		app.log.Printf("Dismissed %d stale approval(s) of PR %d of repo %s", dismissed, pr.GetNumber(), repoName)
+	}
+	return nil
+}
+
+// updateReviewThread records the review thread resolved (or unresolved) by the sender. The reviews of the
+// thread are kept, since the other threads of a review may still be unresolved.
+func updateReviewThread(pr github.PullRequestReviewThreadEvent, app *App) error {
+	if pr.Thread == nil || (pr.GetAction() != "resolved" && pr.GetAction() != "unresolved") {
+		return nil
+	}
+	thread, valid := prp.CreateReviewThread(*pr.Thread, pr.GetAction() == "resolved", pr.GetSender().GetLogin())
+	if !valid {
+		return nil
+	}
+	err := prp.Init(app.db).UpsertReviewThread(pr.GetPullRequest().GetID(), thread)
+	if err != nil {
+		return fmt.Errorf("failed to update the review thread %d of PR %d of repo %s - %w", thread.ThreadId, pr.GetPullRequest().GetNumber(), pr.GetRepo().GetName(), err)
+	}
+	return nil
 }
 
-func uninstallApp(installation github.InstallationEvent, app *App) {
+// recordReviewComment records the review thread started by the review comment, or the reply on its thread
+func recordReviewComment(event github.PullRequestReviewCommentEvent, app *App) error {
+	comment := event.GetComment()
+	if event.GetAction() != "created" || comment == nil {
+		return nil
+	}
+	prModel := prp.Init(app.db)
+	prId := event.GetPullRequest().GetID()
+	var err error
+	if comment.InReplyTo != nil {
+		// The replies are in reply to the first comment of the thread
+		err = prModel.RecordReviewThreadReply(prId, comment.GetInReplyTo(), comment.GetCreatedAt().Unix())
+	} else {
+		err = prModel.AddReviewThread(prId, prp.ReviewThread{
+			ThreadId:      comment.GetID(),
+			ReviewId:      comment.GetPullRequestReviewID(),
+			Author:        comment.GetUser().GetLogin(),
+			LastCommentAt: comment.GetCreatedAt().Unix(),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the review comment %d of PR %d of repo %s - %w", comment.GetID(), event.GetPullRequest().GetNumber(), event.GetRepo().GetName(), err)
+	}
+	return nil
+}
+
+func uninstallApp(installation github.InstallationEvent, app *App) error {
 	if *installation.Action == "deleted" {
+		appTokens(app).Invalidate(*installation.Installation.ID)
 		uDelErr := uc.Init(app.db).Delete(*installation.Installation.ID)
 		if uDelErr != nil {
-			lo.Printf("Failed to delete user %v", uDelErr)
-			return
+			return fmt.Errorf("failed to delete user - %w", uDelErr)
 		}
 		repoDelErr := repository.Init(app.db).DeleteAll(*installation.Installation.ID)
 		if repoDelErr != nil {
-			lo.Printf("Failed to delete repository %v", repoDelErr)
-			return
+			return fmt.Errorf("failed to delete repository - %w", repoDelErr)
 		}
 
+		var err error
 		for _, repo := range installation.Repositories {
 			prDelErr := prp.Init(app.db).DeleteAll(*repo.ID)
 			if prDelErr != nil {
-				lo.Printf("Failed to delete repository %s %v", *repo.Name, prDelErr)
+				err = errors.Join(err, fmt.Errorf("failed to delete repository %s - %w", *repo.Name, prDelErr))
 			}
+			deleteLifetimeHistory(app, *repo.ID)
 		}
+		return err
 	}
+	return nil
 }
 
-func handleInstallRepositoryEvent(installation github.InstallationRepositoriesEvent, app *App) {
+func handleInstallRepositoryEvent(installation github.InstallationRepositoriesEvent, app *App) error {
 	r := repository.Init(app.db)
 	if *installation.Action == "added" {
 		rModel := make([]repository.RepoModel, len(installation.RepositoriesAdded))
@@ -238,14 +567,14 @@ func handleInstallRepositoryEvent(installation github.InstallationRepositoriesEv
 		}
 		err := r.Create(rModel)
 		if err != nil {
-			lo.Printf("Error while populating repos during the install repo event %v", err)
+			return fmt.Errorf("error while populating repos during the install repo event - %w", err)
 		}
-		jwt, _ := provider.GenerateAppJWT(app.ko.String("app.private_key"), app.ko.String("github.app_id"))
-		g := provider.Init(*jwt)
-		iToken, appTokenErr := g.GetAppInstallationAccessToken(*installation.Installation.ID)
+		// The cached token may predate the repositories added to the installation
+		tokens := appTokens(app)
+		tokens.Invalidate(*installation.Installation.ID)
+		iToken, appTokenErr := tokens.InstallationToken(*installation.Installation.ID)
 		if appTokenErr != nil {
-			lo.Printf("Failed to fetch app access token while trying to add PRs %v", appTokenErr)
-			return
+			return fmt.Errorf("failed to fetch app access token while trying to add PRs - %w", appTokenErr)
 		}
 
 		// Populate all the PRs for the repositories added
@@ -254,22 +583,36 @@ func handleInstallRepositoryEvent(installation github.InstallationRepositoriesEv
 			// The webhook does not send the owner information, which is required by
 			// the populateActivePRs method
 		}
-		populateActivePRs(app, iToken.GetToken(), installation.RepositoriesAdded)
+		populateActivePRs(app, iToken, installation.RepositoriesAdded)
 	} else if *installation.Action == "removed" {
 		pr := prp.Init(app.db)
+		var err error
 		for _, repo := range installation.RepositoriesRemoved {
 			if repo != nil {
 				// delete the repos
 				rErr := r.DeleteOneById(*repo.ID)
 				if rErr != nil {
-					lo.Printf("Error removing the repository during the remove repository event %v", rErr)
+					err = errors.Join(err, fmt.Errorf("error removing the repository during the remove repository event - %w", rErr))
 				}
 				// delete all the linked PRs
-				err := pr.DeleteAll(*repo.ID)
-				if err != nil {
-					lo.Printf("Error removing PRs during the remove repository event %v", err)
+				pErr := pr.DeleteAll(*repo.ID)
+				if pErr != nil {
+					err = errors.Join(err, fmt.Errorf("error removing PRs during the remove repository event - %w", pErr))
 				}
+				deleteLifetimeHistory(app, *repo.ID)
 			}
 		}
+		return err
 	}
+	return nil
+}
+
+// installationClient returns the GitHub client authenticated as the app installation
+func installationClient(app *App, installationId int64) (*provider.GitHub, error) {
+	return appTokens(app).Client(installationId)
+}
+
+// appTokens returns the manager of the (cached) installation access tokens of the app
+func appTokens(app *App) *provider.TokenManager {
+	return provider.AppTokens(app.ko.String("app.private_key"), app.ko.String("github.app_id"))
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"nudge/internal/database/webhook"
+	"time"
+)
+
+// webhookQueued wakes up an idle webhook worker when a delivery is queued
+var webhookQueued = make(chan struct{}, 1)
+
+// notifyWebhookWorkers wakes up an idle webhook worker, if any
+func notifyWebhookWorkers() {
+	select {
+	case webhookQueued <- struct{}{}:
+	default:
+	}
+}
+
+// startWebhookWorkers starts the pool of workers processing the queued webhook deliveries, including the ones
+// left over by the previous process. The returned function stops the workers from claiming new deliveries.
+func startWebhookWorkers(app *App) func() {
+	workers := app.ko.Int("webhook.workers")
+	if workers <= 0 {
+		workers = 4
+	}
+	stop := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go runWebhookWorker(app, stop)
+	}
+	app.log.Printf("Started %d webhook workers", workers)
+	return func() {
+		close(stop)
+	}
+}
+
+// runWebhookWorker processes the deliveries as they are due, until it is stopped. The deliveries waiting for
+// their retry are picked up on the poll interval.
+func runWebhookWorker(app *App, stop chan struct{}) {
+	q := webhook.Init(app.db)
+	pollInterval := app.ko.Duration("webhook.poll_interval")
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		delivery, err := q.Claim(time.Now())
+		if err != nil {
+			app.log.Printf("Failed to claim a webhook delivery - %v", err)
+		}
+		if err != nil || delivery == nil {
+			select {
+			case <-stop:
+				return
+			case <-webhookQueued:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		processWebhookDelivery(app, q, *delivery)
+	}
+}
+
+// processWebhookDelivery processes the delivery, and schedules its retry with an exponential backoff if it fails.
+// The delivery is moved to the dead letters once it fails webhook.max_attempts times.
+func processWebhookDelivery(app *App, q *webhook.Queue, delivery webhook.DeliveryModel) {
+	processed, err := q.IsProcessed(delivery.DeliveryId)
+	if err == nil && processed {
+		// Redelivered (e.g. from the settings of the GitHub app) after it was processed
+		app.log.Printf("Skipping the webhook delivery %s (%s), already processed", delivery.DeliveryId, delivery.Event)
+	} else if err == nil {
+		err = processWebhookPayload(app, delivery)
+	}
+	if err == nil {
+		if cErr := q.Complete(delivery); cErr != nil {
+			app.log.Printf("Failed to record the processed webhook delivery %s - %v", delivery.DeliveryId, cErr)
+		}
+		return
+	}
+
+	maxAttempts := app.ko.Int("webhook.max_attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	if delivery.Attempts >= maxAttempts {
+		app.log.Printf("Webhook delivery %s (%s) failed %d times, moving it to the dead letters - %v", delivery.DeliveryId, delivery.Event, delivery.Attempts, err)
+		if dErr := q.DeadLetter(delivery, err.Error()); dErr != nil {
+			app.log.Printf("Failed to move the webhook delivery %s to the dead letters - %v", delivery.DeliveryId, dErr)
+		}
+		return
+	}
+
+	base, max := app.ko.Duration("webhook.backoff"), app.ko.Duration("webhook.max_backoff")
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	if max < base {
+		max = 30 * time.Minute
+	}
+	next := time.Now().Add(webhook.Backoff(delivery.Attempts, base, max))
+	app.log.Printf("Webhook delivery %s (%s) failed attempt %d, retrying at %s - %v", delivery.DeliveryId, delivery.Event, delivery.Attempts, next.Format(time.RFC3339), err)
+	if rErr := q.Retry(delivery.DeliveryId, next, err.Error()); rErr != nil {
+		// The delivery is claimed again once its lease expires
+		app.log.Printf("Failed to schedule the retry of the webhook delivery %s - %v", delivery.DeliveryId, rErr)
+	}
+}
+
+// processWebhookPayload parses the payload of the delivery and processes its event. A panic fails the delivery.
+func processWebhookPayload(app *App, delivery webhook.DeliveryModel) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing the %s event - %v", delivery.Event, r)
+		}
+	}()
+
+	event, pErr := github.ParseWebHook(delivery.Event, []byte(delivery.Payload))
+	if pErr != nil {
+		return errors.Join(errors.New("invalid payload"), pErr)
+	}
+	return processWebhookEvent(delivery.DeliveryId, event, app)
+}
+
+// replayWebhookDeadLetters moves the dead letters (all of them if no delivery id is given) back to the webhook
+// queue, for the server to process them again
+func replayWebhookDeadLetters(app *App, deliveryIds []string) {
+	q := webhook.Init(app.db)
+	if len(deliveryIds) == 0 {
+		deadLetters, err := q.FindDeadLetters()
+		if err != nil {
+			app.log.Printf("Failed to fetch the webhook dead letters - %v", err)
+			return
+		}
+		for _, delivery := range deadLetters {
+			deliveryIds = append(deliveryIds, delivery.DeliveryId)
+		}
+	}
+	for _, deliveryId := range deliveryIds {
+		if err := q.Replay(deliveryId); err != nil {
+			app.log.Printf("Failed to replay the webhook delivery %s - %v", deliveryId, err)
+			continue
+		}
+		app.log.Printf("Replayed the webhook delivery %s", deliveryId)
+	}
+}
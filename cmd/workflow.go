@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/knadh/koanf/v2"
 	"nudge/activity"
 	"nudge/actor"
 	prm "nudge/internal/database/pr"
@@ -8,6 +9,8 @@ import (
 	"nudge/internal/database/user"
 	time2 "nudge/internal/time"
 	"nudge/notify"
+	"nudge/prediction"
+	"nudge/repoconfig"
 	"time"
 )
 
@@ -17,12 +20,14 @@ type WorkflowDependencies struct {
 	NotificationHours notify.NotificationHours
 	NotificationDays  notify.NotificationDaysService
 	User              *user.User
+	LifetimePredictor prediction.LifetimePredictor
 }
 
 func Workflow(workflowDependencies WorkflowDependencies) {
 
 	start := time.Now().Unix()
 	// 1. Determine lifetime effort
+	estimateMissingLifeTimes(workflowDependencies.LifetimePredictor, database)
 
 	// 2. Check for activity
 	delayedPRs, actErr := workflowDependencies.Activity.ActivityCheckTrigger()
@@ -35,15 +40,15 @@ func Workflow(workflowDependencies WorkflowDependencies) {
 	// 3. Identify the actors to notify
 	for _, pr := range *delayedPRs {
 		lo.Printf("Starting for PR#%d in repository %s", pr.DelayedPR.Number, pr.Repository.Name)
-		actorDetails, ierr := workflowDependencies.ActorIdentifier.IdentifyActors(pr.DelayedPR, pr.Repository, ko)
+		actorDetails, ierr := workflowDependencies.ActorIdentifier.IdentifyActors(pr.DelayedPR, pr.Repository, pr.Config)
 		if ierr != nil {
 			lo.Printf("Failed to identify actors for PR %d and repo %s", pr.DelayedPR.Number, pr.Repository.Name)
 			continue
 		}
 		if len(actorDetails) > 0 {
 			tz, bizHours := getUserTimezoneDetails(pr.Repository.InstallationId, workflowDependencies.User)
-			if len(ko.Ints("bot.skip_days")) > 0 {
-				if workflowDependencies.NotificationDays.IsAnyDayInList(tz, time.Now(), ko.Ints("bot.skip_days")) {
+			if len(pr.Config.Ints("bot.skip_days")) > 0 {
+				if workflowDependencies.NotificationDays.IsAnyDayInList(tz, time.Now(), pr.Config.Ints("bot.skip_days")) {
 					// Do not send a nudge on the days mentioned in the configuration
 					lo.Printf("Skipping PR#%d of %s on the days mentioned in the configuration", pr.DelayedPR.Number, pr.Repository.Name)
 					continue
@@ -51,7 +56,7 @@ func Workflow(workflowDependencies WorkflowDependencies) {
 			}
 
 			if pr.DelayedPR.TotalBotComments != nil {
-				if *pr.DelayedPR.TotalBotComments >= ko.Int("bot.follow_up_threshold_comments") {
+				if *pr.DelayedPR.TotalBotComments >= pr.Config.Int("bot.follow_up_threshold_comments") {
 					// Since this has exceeded the total number of comments a bot
 					// can make, will no longer be sending the nudges
 					lo.Printf("Skipping PR#%d of %s since it crossed the threshold", pr.DelayedPR.Number, pr.Repository.Name)
@@ -62,7 +67,7 @@ func Workflow(workflowDependencies WorkflowDependencies) {
 			if pr.DelayedPR.LastBotCommentMadeAt != nil {
 				nt := new(time2.NudgeTime)
 				elapsedHoursSinceLastComment := float64((nt.Now().Unix() - *pr.DelayedPR.LastBotCommentMadeAt) / 3600)
-				if elapsedHoursSinceLastComment < ko.Float64("bot.interval_to_wait.time") {
+				if elapsedHoursSinceLastComment < pr.Config.Float64("bot.interval_to_wait.time") {
 					// Do not send a nudge,
 					// since the comment made is very recent
 					lo.Printf("Skipping PR#%d of %s since the comment made by bot is very recent (%f)hours", pr.DelayedPR.Number, pr.Repository.Name, elapsedHoursSinceLastComment)
@@ -77,11 +82,11 @@ func Workflow(workflowDependencies WorkflowDependencies) {
 				continue
 			}
 
-			actor := actorDetails[0].GithubUserName
-			isReviewer := actorDetails[0].IsReviewer
-			lo.Printf("Review is stuck because of %s", actor)
+			for _, a := range actorDetails {
+				lo.Printf("Review is stuck because of %s (%s)", a.GithubUserName, a.Reason.Code)
+			}
 			// 4. Notify the actors blocking the PR
-			postNotifications(pr.Repository, pr.DelayedPR, actor, isReviewer)
+			postNotifications(pr.Config, pr.Repository, pr.DelayedPR, actorDetails)
 			/**
 			After the notifications have been sent:
 			- Increment the comment counter for this PR
@@ -94,18 +99,23 @@ func Workflow(workflowDependencies WorkflowDependencies) {
 	lo.Printf("Completed the workflow in %v seconds", time.Now().Unix()-start)
 }
 
-// postNotifications sends notifications on GitHub and Slack (if activated). This is the last step in the workflow
-func postNotifications(repository repository.RepoModel, delayedPR prm.PRModel, actor actor.GithubUserName, isReviewer bool) {
-	n := notify.GithubNotificationInit(ko, lo)
-	postErr := n.Post(repository, delayedPR, string(actor), isReviewer)
-	if postErr != nil {
-		lo.Printf("Failed to post a message to the actor blocking the PR %v", postErr)
+// postNotifications sends notifications on GitHub and Slack (if activated), on the channels enabled by the
+// configuration for the repository (config). This is the last step in the workflow
+func postNotifications(config *koanf.Koanf, repository repository.RepoModel, delayedPR prm.PRModel, actors []actor.ActorDetails) {
+	if repoconfig.ChannelEnabled(config, "github") {
+		n := notify.GithubNotificationInit(config, lo)
+		postErr := n.Post(repository, delayedPR, actors)
+		if postErr != nil {
+			lo.Printf("Failed to post a message to the actor blocking the PR %v", postErr)
+		}
 	}
 
-	s := notify.SlackNotificationInit(ko, lo, database)
-	slackErr := s.Post(repository, delayedPR, string(actor), isReviewer)
-	if slackErr != nil {
-		lo.Printf("Failed to post a message to slack %v", slackErr)
+	if repoconfig.ChannelEnabled(config, "slack") {
+		s := notify.SlackNotificationInit(config, lo, database)
+		slackErr := s.Post(repository, delayedPR, actors)
+		if slackErr != nil {
+			lo.Printf("Failed to post a message to slack %v", slackErr)
+		}
 	}
 }
 
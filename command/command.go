@@ -0,0 +1,89 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	prp "nudge/internal/database/pr"
+	"strings"
+	"time"
+)
+
+// Prefix starts the commands to Nudge in the comments of a PR, e.g. /nudge snooze 2d
+const Prefix = "/nudge"
+
+// Name of the command
+type Name string
+
+const (
+	// Snooze holds back the nudges of the PR for a duration (1 day by default)
+	Snooze Name = "snooze"
+	// Stop stops the nudges of the PR until resumed
+	Stop Name = "stop"
+	// Resume resumes the nudges of the PR which have been stopped or snoozed
+	Resume Name = "resume"
+	// Why replies with the actors blocking the PR and the reasons
+	Why Name = "why"
+)
+
+// DefaultSnooze is the duration of a snooze without a duration
+const DefaultSnooze = 24 * time.Hour
+
+// ErrUnknownCommand is returned for a comment with an unknown command
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Command is a command to Nudge, given in a comment of the PR
+type Command struct {
+	Name Name
+	// Duration of the snooze
+	Duration time.Duration
+}
+
+// Parse returns the command of the comment, which is the first line starting with /nudge. Returns
+// nil if the comment has no command.
+func Parse(body string) (*Command, error) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], Prefix) {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: missing the command after %s", ErrUnknownCommand, Prefix)
+		}
+
+		c := &Command{Name: Name(strings.ToLower(fields[1]))}
+		args := fields[2:]
+		switch c.Name {
+		case Snooze:
+			c.Duration = DefaultSnooze
+			if len(args) > 0 {
+				duration, valid := prp.ParseSnoozeDuration(args[0])
+				if !valid {
+					return nil, fmt.Errorf("invalid duration %s, expected <n><h|d|w> e.g. 2d", args[0])
+				}
+				c.Duration = duration
+			}
+		case Stop, Resume, Why:
+		default:
+			return nil, fmt.Errorf("%w %s", ErrUnknownCommand, fields[1])
+		}
+		return c, nil
+	}
+	return nil, nil
+}
+
+// Allowed returns true if the commenter with the permission on the repository (admin, write, read or none)
+// can use the command. The author of the PR and the collaborators with write access can control the nudges
+// of the PR, while anyone with read access can ask why it is blocked.
+func Allowed(c Command, permission string, isAuthor bool) bool {
+	if isAuthor {
+		return true
+	}
+	switch permission {
+	case "admin", "write":
+		return true
+	case "read":
+		return c.Name == Why
+	default:
+		return false
+	}
+}
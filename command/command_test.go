@@ -0,0 +1,53 @@
+package command
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected *Command
+	}{
+		{"snooze", "/nudge snooze 2d", &Command{Name: Snooze, Duration: 48 * time.Hour}},
+		{"snooze_default", "/nudge snooze", &Command{Name: Snooze, Duration: DefaultSnooze}},
+		{"stop", "Thanks!\n/Nudge STOP\n", &Command{Name: Stop}},
+		{"resume", "/nudge resume", &Command{Name: Resume}},
+		{"why", "  /nudge why please", &Command{Name: Why}},
+		{"without_command", "LGTM, see the /nudge docs", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse(tc.body)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, c)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := Parse("/nudge later")
+		assert.True(t, errors.Is(err, ErrUnknownCommand))
+		_, err = Parse("/nudge")
+		assert.True(t, errors.Is(err, ErrUnknownCommand))
+	})
+
+	t.Run("invalid_duration", func(t *testing.T) {
+		_, err := Parse("/nudge snooze 2 days")
+		assert.Error(t, err)
+	})
+}
+
+func TestAllowed(t *testing.T) {
+	assert.True(t, Allowed(Command{Name: Stop}, "admin", false))
+	assert.True(t, Allowed(Command{Name: Snooze}, "write", false))
+	assert.False(t, Allowed(Command{Name: Snooze}, "read", false))
+	assert.True(t, Allowed(Command{Name: Snooze}, "read", true))
+	assert.True(t, Allowed(Command{Name: Why}, "read", false))
+	assert.True(t, Allowed(Command{Name: Stop}, "none", true))
+	assert.False(t, Allowed(Command{Name: Why}, "none", false))
+}
@@ -6,6 +6,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
 	"time"
 )
 
@@ -26,12 +27,29 @@ const (
 	UserCollection       = "user"
 	RepositoryCollection = "repositories"
 	PRCollection         = "pr"
+	PROutcomeCollection  = "pr_outcomes"
+	LifetimeCollection   = "lifetime_models"
+	// WebhookQueueCollection holds the webhook deliveries until they are processed,
+	// WebhookDeadLetterCollection the deliveries which failed all their attempts, and
+	// WebhookDeliveryCollection the deliveries processed within WebhookDeliveryTTL
+	WebhookQueueCollection      = "webhook_queue"
+	WebhookDeadLetterCollection = "webhook_dead_letters"
+	WebhookDeliveryCollection   = "webhook_deliveries"
 )
 
+// WebhookDeliveryTTL is how long a processed webhook delivery is remembered, to skip its redeliveries.
+// GitHub lets the deliveries of the past 3 days be redelivered.
+const WebhookDeliveryTTL = 7 * 24 * time.Hour
+
 var availableCollections = []string{
 	UserCollection,
 	RepositoryCollection,
 	PRCollection,
+	PROutcomeCollection,
+	LifetimeCollection,
+	WebhookQueueCollection,
+	WebhookDeadLetterCollection,
+	WebhookDeliveryCollection,
 }
 
 var indexDetails = map[string][]mongo.IndexModel{
@@ -49,19 +67,98 @@ var indexDetails = map[string][]mongo.IndexModel{
 	PRCollection: {
 		{Keys: bson.D{{"repo_id", 1}}},
 		{Keys: bson.D{{"number", 1}}},
-		{Keys: bson.D{{"prid", 1}}},
+		{Keys: bson.D{{"prid", 1}}, Options: options.Index().SetUnique(true)},
+	},
+	PROutcomeCollection: {
+		{Keys: bson.D{{"prid", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"repo_id", 1}, {"author", 1}}},
+	},
+	LifetimeCollection: {
+		{Keys: bson.D{{"repo_id", 1}}, Options: options.Index().SetUnique(true)},
+	},
+	WebhookQueueCollection: {
+		{Keys: bson.D{{"delivery_id", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"next_attempt_at", 1}, {"locked_until", 1}}},
+	},
+	WebhookDeadLetterCollection: {
+		{Keys: bson.D{{"delivery_id", 1}}, Options: options.Index().SetUnique(true)},
+	},
+	WebhookDeliveryCollection: {
+		{Keys: bson.D{{"delivery_id", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"processed_at", 1}}, Options: options.Index().SetExpireAfterSeconds(int32(WebhookDeliveryTTL.Seconds()))},
 	},
 }
 
-func SyncIndexes(db *mongo.Database) {
+// SyncIndexes creates the indexes of the collections which do not exist yet. The failures are logged, and do not
+// stop the other indexes from being created.
+func SyncIndexes(db *mongo.Database, lo *log.Logger) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
+	if err := migrateUniquePRId(ctx, db, lo); err != nil {
+		lo.Printf("Failed to migrate the prid index of the PRs to a unique index - %v", err)
+	}
 	for _, collection := range availableCollections {
 		_, has := indexDetails[collection]
 		if has {
-			db.Collection(collection).Indexes().CreateMany(ctx, indexDetails[collection])
+			if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexDetails[collection]); err != nil {
+				lo.Printf("Failed to create the indexes of the %s collection - %v", collection, err)
+			}
+		}
+	}
+}
+
+// migrateUniquePRId replaces the non-unique prid index of the PRs, created by the previous versions, with the
+// unique one. The duplicates of a PR are deleted first, keeping the first inserted record: the updates by prid
+// were applied to it, while the duplicates are the blank copies written by the redelivered opened events.
+func migrateUniquePRId(ctx context.Context, db *mongo.Database, lo *log.Logger) error {
+	collection := db.Collection(PRCollection)
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the indexes - %w", err)
+	}
+	var indexes []bson.M
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return fmt.Errorf("failed to read the indexes - %w", err)
+	}
+	legacy := false
+	for _, index := range indexes {
+		if index["name"] == "prid_1" && index["unique"] != true {
+			legacy = true
 		}
 	}
+	if !legacy {
+		return nil
+	}
+
+	cursor, err = collection.Aggregate(ctx, mongo.Pipeline{
+		{{"$sort", bson.D{{"_id", 1}}}},
+		{{"$group", bson.D{{"_id", "$prid"}, {"ids", bson.D{{"$push", "$_id"}}}, {"count", bson.D{{"$sum", 1}}}}}},
+		{{"$match", bson.D{{"count", bson.D{{"$gt", 1}}}}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find the duplicate PRs - %w", err)
+	}
+	var duplicates []struct {
+		PRId int64         `bson:"_id"`
+		Ids  []interface{} `bson:"ids"`
+	}
+	if err = cursor.All(ctx, &duplicates); err != nil {
+		return fmt.Errorf("failed to read the duplicate PRs - %w", err)
+	}
+	var deleted int64
+	for _, duplicate := range duplicates {
+		result, dErr := collection.DeleteMany(ctx, bson.D{{"_id", bson.D{{"$in", duplicate.Ids[1:]}}}})
+		if dErr != nil {
+			lo.Printf("Deleted %d duplicate PRs before failing to migrate the prid index", deleted)
+			return fmt.Errorf("failed to delete the duplicates of PR %d - %w", duplicate.PRId, dErr)
+		}
+		deleted += result.DeletedCount
+	}
+	lo.Printf("Deleted %d duplicate records of %d PRs to migrate the prid index", deleted, len(duplicates))
+	if _, err = collection.Indexes().DropOne(ctx, "prid_1"); err != nil {
+		return fmt.Errorf("failed to drop the non-unique prid index - %w", err)
+	}
+	return nil
 }
 
 func ParseDatabaseError(err error) error {
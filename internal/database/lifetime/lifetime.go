@@ -0,0 +1,78 @@
+package lifetime
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nudge/internal/database"
+	time2 "nudge/internal/time"
+	"nudge/prediction"
+	"time"
+)
+
+// LifetimeModel holds the coefficients of the lifetime prediction fitted for a repository
+type LifetimeModel struct {
+	RepoId       int64                   `json:"repo_id" bson:"repo_id"`
+	Coefficients prediction.Coefficients `json:"coefficients" bson:"coefficients"`
+	Samples      int                     `json:"samples" bson:"samples"`
+	TrainedAt    int64                   `json:"trained_at" bson:"trained_at"`
+	UpdatedAt    int64                   `json:"updated_at" bson:"updated_at"`
+}
+
+type Lifetime struct {
+	Collection *mongo.Collection
+}
+
+func Init(db *mongo.Database) *Lifetime {
+	return &Lifetime{
+		Collection: db.Collection(database.LifetimeCollection),
+	}
+}
+
+// Upsert stores the coefficients fitted for the repository, replacing the previously trained ones
+func (l *Lifetime) Upsert(repoId int64, coefficients prediction.Coefficients, samples int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	model := LifetimeModel{
+		RepoId:       repoId,
+		Coefficients: coefficients,
+		Samples:      samples,
+		TrainedAt:    ts,
+		UpdatedAt:    ts,
+	}
+	where := map[string]int64{
+		"repo_id": repoId,
+	}
+	_, err := l.Collection.ReplaceOne(ctx, where, model, options.Replace().SetUpsert(true))
+	return err
+}
+
+// FindCoefficients returns the coefficients trained for the repository
+func (l *Lifetime) FindCoefficients(repoId int64) (*prediction.Coefficients, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	where := map[string]int64{
+		"repo_id": repoId,
+	}
+
+	var model LifetimeModel
+	err := l.Collection.FindOne(ctx, where, nil).Decode(&model)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Coefficients, nil
+}
+
+func (l *Lifetime) DeleteOne(repoId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	where := map[string]int64{
+		"repo_id": repoId,
+	}
+	_, err := l.Collection.DeleteOne(ctx, where)
+	return err
+}
@@ -0,0 +1,79 @@
+package lifetime
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"nudge/prediction"
+	"os"
+	"testing"
+	"time"
+)
+
+var dbTest *mongo.Database
+
+// setUp is called to initialize the test database.
+func setUp() {
+	mongodbURI := os.Getenv("MONGODB_URI_TEST")
+	if mongodbURI == "" {
+		mongodbURI = "mongodb://localhost:27017/test_lifetime" // Replace with your MongoDB test instance URI
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongodbURI))
+	if err != nil {
+		fmt.Println("Cannot create Mongo client", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		fmt.Println("Cannot connect to Mongo", err)
+		os.Exit(1)
+	}
+
+	err = client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		fmt.Println("Cannot ping Mongo", err)
+		os.Exit(1)
+	}
+
+	dbTest = client.Database("test_lifetime") // Replace 'test_lifetime' with your test database name
+}
+
+// tearDown is called to clean up the test database.
+func tearDown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = dbTest.Drop(ctx)
+}
+
+func TestLifetime_Upsert(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	l := Init(dbTest)
+	_, err := l.FindCoefficients(1)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	err = l.Upsert(1, prediction.Coefficients{Intercept: 1, MinHours: 1, MaxHours: 10}, 20)
+	assert.NoError(t, err)
+	err = l.Upsert(1, prediction.Coefficients{Intercept: 2, MinHours: 1, MaxHours: 20}, 30)
+	assert.NoError(t, err)
+
+	coefficients, err := l.FindCoefficients(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, coefficients.Intercept)
+	assert.Equal(t, 20, coefficients.MaxHours)
+
+	err = l.DeleteOne(1)
+	assert.NoError(t, err)
+	_, err = l.FindCoefficients(1)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
@@ -0,0 +1,206 @@
+package outcome
+
+import (
+	"context"
+	"github.com/google/go-github/v52/github"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nudge/internal/database"
+	time2 "nudge/internal/time"
+	"nudge/prediction"
+	"sort"
+	"time"
+)
+
+// OutcomeModel is a merged pull request, as used to train the lifetime prediction
+type OutcomeModel struct {
+	PRID         int64    `json:"prid" bson:"prid"`
+	Number       int      `json:"number" bson:"number"`
+	RepoId       int64    `json:"repo_id" bson:"repo_id"`
+	Author       string   `json:"author" bson:"author"`
+	PRCreatedAt  int64    `json:"pr_created_at" bson:"pr_created_at"`
+	PRMergedAt   int64    `json:"pr_merged_at" bson:"pr_merged_at"`
+	LinesAdded   int      `json:"lines_added" bson:"lines_added"`
+	LinesDeleted int      `json:"lines_deleted" bson:"lines_deleted"`
+	FilesChanged int      `json:"files_changed" bson:"files_changed"`
+	Commits      int      `json:"commits" bson:"commits"`
+	Reviewers    []string `json:"reviewers" bson:"reviewers"`
+	// ReviewRounds is the number of distinct commits which were reviewed
+	ReviewRounds int   `json:"review_rounds" bson:"review_rounds"`
+	CreatedAt    int64 `json:"created_at" bson:"created_at"`
+	UpdatedAt    int64 `json:"updated_at" bson:"updated_at"`
+}
+
+type Outcome struct {
+	Collection *mongo.Collection
+}
+
+func Init(db *mongo.Database) *Outcome {
+	return &Outcome{
+		Collection: db.Collection(database.PROutcomeCollection),
+	}
+}
+
+// LifeTimeHours returns the hours the pull request took from creation to merge
+func (om OutcomeModel) LifeTimeHours() float64 {
+	return float64(om.PRMergedAt-om.PRCreatedAt) / 3600
+}
+
+// BulkUpsert inserts the outcomes, replacing the ones already recorded for the same PR
+func (o *Outcome) BulkUpsert(outcomes []*OutcomeModel) error {
+	if len(outcomes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	writes := make([]mongo.WriteModel, len(outcomes))
+	for i, om := range outcomes {
+		ts := nudgeTime.NudgeTime().Unix()
+		om.CreatedAt = ts
+		om.UpdatedAt = ts
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(map[string]interface{}{"prid": om.PRID}).
+			SetReplacement(om).
+			SetUpsert(true)
+	}
+	_, err := o.Collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// GetAll returns the outcomes of the repository, ordered by the creation time of the PRs
+func (o *Outcome) GetAll(repoId int64) ([]OutcomeModel, error) {
+	return o.find(map[string]interface{}{
+		"repo_id": repoId,
+	})
+}
+
+// GetPRIds returns the ids of the PRs of the repository whose outcomes have been recorded
+func (o *Outcome) GetPRIds(repoId int64) (map[int64]bool, error) {
+	outcomes, err := o.GetAll(repoId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool)
+	for _, om := range outcomes {
+		ids[om.PRID] = true
+	}
+	return ids, nil
+}
+
+// AuthorMergeHours returns the lifetimes (in hours) of the pull requests merged by the author in the repository
+func (o *Outcome) AuthorMergeHours(repoId int64, author string) ([]float64, error) {
+	outcomes, err := o.find(map[string]interface{}{
+		"repo_id": repoId,
+		"author":  author,
+	})
+	return lifeTimeHours(outcomes), err
+}
+
+// RepositoryMergeHours returns the lifetimes (in hours) of the pull requests merged in the repository
+func (o *Outcome) RepositoryMergeHours(repoId int64) ([]float64, error) {
+	outcomes, err := o.GetAll(repoId)
+	return lifeTimeHours(outcomes), err
+}
+
+func (o *Outcome) DeleteAll(repoId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	where := map[string]int64{
+		"repo_id": repoId,
+	}
+	_, err := o.Collection.DeleteMany(ctx, where)
+	return err
+}
+
+func (o *Outcome) find(where map[string]interface{}) ([]OutcomeModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(map[string]int{"pr_created_at": 1})
+	cursor, err := o.Collection.Find(ctx, where, opts)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]OutcomeModel, 0)
+	if err = cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func lifeTimeHours(outcomes []OutcomeModel) []float64 {
+	hours := make([]float64, 0)
+	for _, om := range outcomes {
+		hours = append(hours, om.LifeTimeHours())
+	}
+	return hours
+}
+
+// CreateDataModelForOutcome creates the outcome record of the merged pull request from its reviews
+func CreateDataModelForOutcome(pr github.PullRequest, repoId int64, reviews []*github.PullRequestReview) *OutcomeModel {
+	model := new(OutcomeModel)
+	model.PRID = pr.GetID()
+	model.Number = pr.GetNumber()
+	model.RepoId = repoId
+	model.Author = pr.GetUser().GetLogin()
+	model.PRCreatedAt = pr.GetCreatedAt().Unix()
+	model.PRMergedAt = pr.GetMergedAt().Unix()
+	model.LinesAdded = pr.GetAdditions()
+	model.LinesDeleted = pr.GetDeletions()
+	model.FilesChanged = pr.GetChangedFiles()
+	model.Commits = pr.GetCommits()
+
+	reviewers := make([]string, 0)
+	seenReviewers := make(map[string]bool)
+	reviewedCommits := make(map[string]bool)
+	for _, r := range reviews {
+		login := r.GetUser().GetLogin()
+		if len(login) > 0 && login != model.Author && !seenReviewers[login] {
+			seenReviewers[login] = true
+			reviewers = append(reviewers, login)
+		}
+		if r.CommitID != nil {
+			reviewedCommits[*r.CommitID] = true
+		}
+	}
+	model.Reviewers = reviewers
+	model.ReviewRounds = len(reviewedCommits)
+
+	return model
+}
+
+// TrainingSamples converts the outcomes of a repository into the samples for the lifetime model.
+// The author's history of a sample only includes the pull requests merged before it was created.
+func TrainingSamples(outcomes []OutcomeModel) []prediction.Sample {
+	sorted := make([]OutcomeModel, len(outcomes))
+	copy(sorted, outcomes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PRCreatedAt < sorted[j].PRCreatedAt
+	})
+
+	samples := make([]prediction.Sample, 0)
+	for _, om := range sorted {
+		authorHistory := make([]float64, 0)
+		for _, previous := range sorted {
+			if previous.Author == om.Author && previous.PRMergedAt < om.PRCreatedAt {
+				authorHistory = append(authorHistory, previous.LifeTimeHours())
+			}
+		}
+		samples = append(samples, prediction.Sample{
+			Features: prediction.Features{
+				RepoId:           om.RepoId,
+				LinesAdded:       om.LinesAdded,
+				LinesDeleted:     om.LinesDeleted,
+				FilesChanged:     om.FilesChanged,
+				Commits:          om.Commits,
+				Reviewers:        len(om.Reviewers),
+				AuthorMergeHours: authorHistory,
+			},
+			LifeTimeHours: om.LifeTimeHours(),
+		})
+	}
+	return samples
+}
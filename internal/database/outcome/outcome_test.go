@@ -0,0 +1,148 @@
+package outcome
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"os"
+	"testing"
+	"time"
+)
+
+var dbTest *mongo.Database
+
+// setUp is called to initialize the test database.
+func setUp() {
+	mongodbURI := os.Getenv("MONGODB_URI_TEST")
+	if mongodbURI == "" {
+		mongodbURI = "mongodb://localhost:27017/test_outcome" // Replace with your MongoDB test instance URI
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongodbURI))
+	if err != nil {
+		fmt.Println("Cannot create Mongo client", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		fmt.Println("Cannot connect to Mongo", err)
+		os.Exit(1)
+	}
+
+	err = client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		fmt.Println("Cannot ping Mongo", err)
+		os.Exit(1)
+	}
+
+	dbTest = client.Database("test_outcome") // Replace 'test_outcome' with your test database name
+}
+
+// tearDown is called to clean up the test database.
+func tearDown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = dbTest.Drop(ctx)
+}
+
+func TestOutcome_BulkUpsert(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	o := Init(dbTest)
+	outcomes := []*OutcomeModel{
+		{PRID: 1, RepoId: 1, Author: "author", PRCreatedAt: 0, PRMergedAt: 7200},
+		{PRID: 2, RepoId: 1, Author: "someone-else", PRCreatedAt: 3600, PRMergedAt: 18000},
+	}
+	err := o.BulkUpsert(outcomes)
+	assert.NoError(t, err)
+
+	// Upserting the same PR again must replace the existing outcome
+	err = o.BulkUpsert([]*OutcomeModel{{PRID: 1, RepoId: 1, Author: "author", PRCreatedAt: 0, PRMergedAt: 3600}})
+	assert.NoError(t, err)
+
+	all, err := o.GetAll(1)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, int64(1), all[0].PRID)
+
+	ids, err := o.GetPRIds(1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]bool{1: true, 2: true}, ids)
+
+	hours, err := o.AuthorMergeHours(1, "author")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1}, hours)
+
+	hours, err = o.RepositoryMergeHours(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 4}, hours)
+
+	err = o.DeleteAll(1)
+	assert.NoError(t, err)
+	all, err = o.GetAll(1)
+	assert.NoError(t, err)
+	assert.Len(t, all, 0)
+}
+
+func TestCreateDataModelForOutcome(t *testing.T) {
+	createdAt := time.Now().Add(-10 * time.Hour)
+	mergedAt := time.Now()
+	pr := github.PullRequest{
+		ID:           github.Int64(10),
+		Number:       github.Int(3),
+		User:         &github.User{Login: github.String("author")},
+		CreatedAt:    &github.Timestamp{Time: createdAt},
+		MergedAt:     &github.Timestamp{Time: mergedAt},
+		Additions:    github.Int(120),
+		Deletions:    github.Int(30),
+		ChangedFiles: github.Int(4),
+		Commits:      github.Int(3),
+	}
+	reviews := []*github.PullRequestReview{
+		{User: &github.User{Login: github.String("reviewer1")}, CommitID: github.String("a"), State: github.String("CHANGES_REQUESTED")},
+		{User: &github.User{Login: github.String("author")}, CommitID: github.String("a"), State: github.String("COMMENTED")},
+		{User: &github.User{Login: github.String("reviewer1")}, CommitID: github.String("b"), State: github.String("APPROVED")},
+		{User: &github.User{Login: github.String("reviewer2")}, CommitID: github.String("b"), State: github.String("APPROVED")},
+	}
+
+	model := CreateDataModelForOutcome(pr, 1, reviews)
+	assert.Equal(t, int64(10), model.PRID)
+	assert.Equal(t, "author", model.Author)
+	assert.Equal(t, 120, model.LinesAdded)
+	assert.Equal(t, 30, model.LinesDeleted)
+	assert.Equal(t, 4, model.FilesChanged)
+	assert.Equal(t, 3, model.Commits)
+	assert.Equal(t, []string{"reviewer1", "reviewer2"}, model.Reviewers)
+	assert.Equal(t, 2, model.ReviewRounds)
+	assert.InDelta(t, 10, model.LifeTimeHours(), 0.01)
+}
+
+func TestTrainingSamples(t *testing.T) {
+	outcomes := []OutcomeModel{
+		{PRID: 3, Author: "author", PRCreatedAt: 10 * 3600, PRMergedAt: 12 * 3600, Reviewers: []string{"r1"}},
+		{PRID: 1, Author: "author", PRCreatedAt: 0, PRMergedAt: 4 * 3600, Reviewers: []string{"r1", "r2"}},
+		{PRID: 2, Author: "someone-else", PRCreatedAt: 3600, PRMergedAt: 3 * 3600},
+		{PRID: 4, Author: "author", PRCreatedAt: 11 * 3600, PRMergedAt: 20 * 3600},
+	}
+
+	samples := TrainingSamples(outcomes)
+	assert.Len(t, samples, 4)
+	// Sorted by creation, the first PR of the author has no history
+	assert.Equal(t, 4.0, samples[0].LifeTimeHours)
+	assert.Equal(t, 2, samples[0].Features.Reviewers)
+	assert.Len(t, samples[0].Features.AuthorMergeHours, 0)
+	assert.Len(t, samples[1].Features.AuthorMergeHours, 0)
+	assert.Equal(t, []float64{4}, samples[2].Features.AuthorMergeHours)
+	// PR#3 was not merged when PR#4 was created
+	assert.Equal(t, []float64{4}, samples[3].Features.AuthorMergeHours)
+}
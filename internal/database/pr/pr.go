@@ -5,9 +5,11 @@ import (
 	"errors"
 	"github.com/google/go-github/v52/github"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"nudge/internal/database"
 	time2 "nudge/internal/time"
-	"nudge/prediction"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,25 +23,67 @@ const (
 	WorkflowActionTypePull    = "pull"
 )
 
+// Signals observed in the pull request environment, used for the activity detection
+const (
+	SignalStateChange  = "state_change"
+	SignalComment      = "comment"
+	SignalThreadStatus = "thread_status"
+	SignalCommit       = "commit"
+	SignalReview       = "review"
+	// SignalAcknowledgement is an actor acknowledging the nudge, e.g. with "I'm on it" on Slack
+	SignalAcknowledgement = "acknowledgement"
+)
+
+// CI states of the head commit of the PR
+const (
+	CIStatePending = "pending"
+	CIStateSuccess = "success"
+	CIStateFailure = "failure"
+)
+
+// ReviewStateDismissed is the state of a review dismissed by a maintainer (or by a push, when the stale reviews
+// are dismissed), which no longer approves the PR or requests changes
+const ReviewStateDismissed = "dismissed"
+
+// SnoozeLabelPrefix is the prefix of the labels snoozing the nudges of the PR for a duration, e.g. nudge-snooze-3d
+const SnoozeLabelPrefix = "nudge-snooze-"
+
+// maxActivitySignals is the number of most recent signals retained on a PR
+const maxActivitySignals = 50
+
 type PRModel struct {
-	Number                             int       `json:"number" bson:"number"`
-	PRID                               int64     `json:"prid" bson:"prid"`
-	RepoId                             int64     `json:"repo_id" bson:"repo_id"`
-	Status                             string    `json:"status" bson:"status"`
-	Draft                              *bool     `json:"draft,omitempty" bson:"draft,omitempty"`
-	LifeTime                           int       `json:"life_time" bson:"life_time"`
-	WorkflowState                      int       `json:"workflow_state" bson:"workflow_state"`
-	WorkflowLastActivity               *int64    `json:"workflow_last_activity,omitempty" bson:"workflow_last_activity,omitempty"`
-	LastWorkflowActionRecorded         *string   `json:"last_workflow_action_recorded,omitempty" bson:"last_workflow_action_recorded,omitempty"`
-	LastWorkflowActionCategoryRecorded *string   `json:"last_workflow_action_category_recorded,omitempty" bson:"last_workflow_action_category_recorded,omitempty"`
-	RequestedReviewers                 *[]string `json:"requested_reviewers,omitempty" bson:"requested_reviewers,omitempty"`
-	Reviews                            *[]Review `json:"reviews,omitempty" bson:"reviews,omitempty"`
-	TotalBotComments                   *int      `json:"total_bot_comments,omitempty" bson:"total_bot_comments,omitempty"`
-	LastBotCommentMadeAt               *int64    `json:"last_bot_comment_made_at,omitempty" bson:"last_bot_comment_made_at,omitempty"`
-	PRCreatedAt                        int64     `json:"pr_created_at" bson:"pr_created_at"`
-	PRUpdatedAt                        int64     `json:"pr_updated_at" bson:"pr_updated_at"`
-	CreatedAt                          int64     `bson:"created_at" json:"created_at" bson:"created_at"`
-	UpdatedAt                          int64     `bson:"updated_at" json:"updated_at" bson:"updated_at"`
+	Number                             int                 `json:"number" bson:"number"`
+	PRID                               int64               `json:"prid" bson:"prid"`
+	RepoId                             int64               `json:"repo_id" bson:"repo_id"`
+	Status                             string              `json:"status" bson:"status"`
+	Title                              *string             `json:"title,omitempty" bson:"title,omitempty"`
+	Author                             *string             `json:"author,omitempty" bson:"author,omitempty"`
+	Draft                              *bool               `json:"draft,omitempty" bson:"draft,omitempty"`
+	Labels                             *[]string           `json:"labels,omitempty" bson:"labels,omitempty"`
+	SnoozedUntil                       *int64              `json:"snoozed_until,omitempty" bson:"snoozed_until,omitempty"`
+	NudgeDisabled                      *bool               `json:"nudge_disabled,omitempty" bson:"nudge_disabled,omitempty"`
+	LifeTime                           int                 `json:"life_time" bson:"life_time"`
+	LifeTimeRevisions                  *[]LifeTimeRevision `json:"life_time_revisions,omitempty" bson:"life_time_revisions,omitempty"`
+	WorkflowState                      int                 `json:"workflow_state" bson:"workflow_state"`
+	WorkflowLastActivity               *int64              `json:"workflow_last_activity,omitempty" bson:"workflow_last_activity,omitempty"`
+	LastWorkflowActionRecorded         *string             `json:"last_workflow_action_recorded,omitempty" bson:"last_workflow_action_recorded,omitempty"`
+	LastWorkflowActionCategoryRecorded *string             `json:"last_workflow_action_category_recorded,omitempty" bson:"last_workflow_action_category_recorded,omitempty"`
+	RequestedReviewers                 *[]string           `json:"requested_reviewers,omitempty" bson:"requested_reviewers,omitempty"`
+	RequestedTeams                     *[]string           `json:"requested_teams,omitempty" bson:"requested_teams,omitempty"`
+	Reviews                            *[]Review           `json:"reviews,omitempty" bson:"reviews,omitempty"`
+	ReviewThreads                      *[]ReviewThread     `json:"review_threads,omitempty" bson:"review_threads,omitempty"`
+	ReviewRequests                     *[]ReviewRequest    `json:"review_requests,omitempty" bson:"review_requests,omitempty"`
+	ActivitySignals                    *[]ActivitySignal   `json:"activity_signals,omitempty" bson:"activity_signals,omitempty"`
+	HeadSHA                            *string             `json:"head_sha,omitempty" bson:"head_sha,omitempty"`
+	CIChecks                           *[]CICheck          `json:"ci_checks,omitempty" bson:"ci_checks,omitempty"`
+	CIState                            *string             `json:"ci_state,omitempty" bson:"ci_state,omitempty"`
+	CIPendingSince                     *int64              `json:"ci_pending_since,omitempty" bson:"ci_pending_since,omitempty"`
+	TotalBotComments                   *int                `json:"total_bot_comments,omitempty" bson:"total_bot_comments,omitempty"`
+	LastBotCommentMadeAt               *int64              `json:"last_bot_comment_made_at,omitempty" bson:"last_bot_comment_made_at,omitempty"`
+	PRCreatedAt                        int64               `json:"pr_created_at" bson:"pr_created_at"`
+	PRUpdatedAt                        int64               `json:"pr_updated_at" bson:"pr_updated_at"`
+	CreatedAt                          int64               `bson:"created_at" json:"created_at" bson:"created_at"`
+	UpdatedAt                          int64               `bson:"updated_at" json:"updated_at" bson:"updated_at"`
 }
 
 type Review struct {
@@ -49,6 +93,57 @@ type Review struct {
 	SubmittedAt *int64  `json:"submitted_at,omitempty" bson:"submitted_at,omitempty"`
 }
 
+// ReviewThread is a thread of review comments on the diff of the PR. GitHub does not expose a numeric id of the
+// thread to the webhooks, so the thread is identified by the id of its first comment.
+type ReviewThread struct {
+	ThreadId int64 `json:"thread_id" bson:"thread_id"`
+	// ReviewId is the review in which the thread was started
+	ReviewId int64 `json:"review_id" bson:"review_id"`
+	// Author started the thread
+	Author        string  `json:"author" bson:"author"`
+	Resolved      bool    `json:"resolved" bson:"resolved"`
+	ResolvedBy    *string `json:"resolved_by,omitempty" bson:"resolved_by,omitempty"`
+	LastCommentAt int64   `json:"last_comment_at" bson:"last_comment_at"`
+}
+
+// ReviewRequest is the latest request for the reviewer to review the PR. A reviewer requested again after their
+// latest review (e.g. once the author pushed the changes) is yet to review the PR again.
+type ReviewRequest struct {
+	Reviewer    string `json:"reviewer" bson:"reviewer"`
+	RequestedAt int64  `json:"requested_at" bson:"requested_at"`
+}
+
+// ActivitySignal is an action performed on the PR by an actor
+type ActivitySignal struct {
+	Signal     string `json:"signal" bson:"signal"`
+	Action     string `json:"action" bson:"action"`
+	Actor      string `json:"actor" bson:"actor"`
+	IsBot      bool   `json:"is_bot" bson:"is_bot"`
+	OccurredAt int64  `json:"occurred_at" bson:"occurred_at"`
+	// DeliveryId is the webhook delivery which carried the signal, for its retries not to record it again
+	DeliveryId string `json:"delivery_id,omitempty" bson:"delivery_id,omitempty"`
+}
+
+// CICheck is the latest state of a check (or commit status) reported on the head commit of the PR
+type CICheck struct {
+	Name      string `json:"name" bson:"name"`
+	State     string `json:"state" bson:"state"`
+	UpdatedAt int64  `json:"updated_at" bson:"updated_at"`
+}
+
+// LifeTimeRevision records a change of the predicted lifetime, along with
+// the event and the size of the PR which caused it
+type LifeTimeRevision struct {
+	PreviousLifeTime int    `json:"previous_life_time" bson:"previous_life_time"`
+	LifeTime         int    `json:"life_time" bson:"life_time"`
+	Action           string `json:"action" bson:"action"`
+	LinesAdded       int    `json:"lines_added" bson:"lines_added"`
+	LinesDeleted     int    `json:"lines_deleted" bson:"lines_deleted"`
+	FilesChanged     int    `json:"files_changed" bson:"files_changed"`
+	Commits          int    `json:"commits" bson:"commits"`
+	RevisedAt        int64  `json:"revised_at" bson:"revised_at"`
+}
+
 type PR struct {
 	Collection *mongo.Collection
 }
@@ -90,6 +185,10 @@ func (pr *PR) Create(prm *PRModel) error {
 	prm.UpdatedAt = ts
 
 	_, err := pr.Collection.InsertOne(ctx, prm)
+	if mongo.IsDuplicateKeyError(err) {
+		// The PR is already recorded, e.g. on a redelivery of its opened event
+		return nil
+	}
 	if err != nil {
 		return database.ParseDatabaseError(err)
 	}
@@ -113,7 +212,11 @@ func (pr *PR) BulkCreate(prms []*PRModel) error {
 		prm.UpdatedAt = ts
 		prmsToCreate[i] = prm
 	}
-	_, err := pr.Collection.InsertMany(ctx, prmsToCreate, nil)
+	// The PRs already recorded are skipped, while the others are inserted
+	_, err := pr.Collection.InsertMany(ctx, prmsToCreate, options.InsertMany().SetOrdered(false))
+	if onlyDuplicates(err) {
+		return nil
+	}
 	return err
 }
 
@@ -153,6 +256,64 @@ func (pr *PR) UpdateByPRId(prId int64, toUpdate interface{}) error {
 }
 
 func (pr *PR) UpdateReviewer(prId int64, reviewer string, remove bool) error {
+	return pr.updateRequested(prId, "requested_reviewers", reviewer, remove)
+}
+
+// UpdateTeamReviewer adds (or removes) the team (org/team) requested to review the PR
+func (pr *PR) UpdateTeamReviewer(prId int64, team string, remove bool) error {
+	return pr.updateRequested(prId, "requested_teams", team, remove)
+}
+
+// UpdateLabel adds (or removes) the label of the PR
+func (pr *PR) UpdateLabel(prId int64, label string, remove bool) error {
+	return pr.updateRequested(prId, "labels", label, remove)
+}
+
+// UpdateSnooze snoozes the nudges of the PR until the time (unix seconds). A nil time ends the snooze.
+func (pr *PR) UpdateSnooze(prId int64, until *int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	toUpdate := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"updated_at": nudgeTime.NudgeTime().Unix(),
+		},
+	}
+	if until != nil {
+		toUpdate["$set"].(map[string]interface{})["snoozed_until"] = *until
+	} else {
+		toUpdate["$unset"] = map[string]interface{}{
+			"snoozed_until": "",
+		}
+	}
+	_, err := pr.Collection.UpdateOne(ctx, map[string]int64{"prid": prId}, toUpdate)
+	return err
+}
+
+// UpdateNudgeDisabled stops (or resumes) the nudges of the PR
+func (pr *PR) UpdateNudgeDisabled(prId int64, disabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	toUpdate := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"updated_at": nudgeTime.NudgeTime().Unix(),
+		},
+	}
+	if disabled {
+		toUpdate["$set"].(map[string]interface{})["nudge_disabled"] = true
+	} else {
+		toUpdate["$unset"] = map[string]interface{}{
+			"nudge_disabled": "",
+		}
+	}
+	_, err := pr.Collection.UpdateOne(ctx, map[string]int64{"prid": prId}, toUpdate)
+	return err
+}
+
+func (pr *PR) updateRequested(prId int64, field string, value string, remove bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -165,11 +326,11 @@ func (pr *PR) UpdateReviewer(prId int64, reviewer string, remove bool) error {
 
 	if remove {
 		toPull := make(map[string]string)
-		toPull["requested_reviewers"] = reviewer
+		toPull[field] = value
 		toUpdate["$pull"] = toPull
 	} else {
 		toPush := make(map[string]string)
-		toPush["requested_reviewers"] = reviewer
+		toPush[field] = value
 		toUpdate["$addToSet"] = toPush
 	}
 	toUpdate["$set"] = map[string]interface{}{
@@ -196,13 +357,336 @@ func (pr *PR) UpdateReview(prId int64, review Review, remove bool) error {
 			ReviewId: review.ReviewId,
 		}
 		toUpdate["$pull"] = toPull
-	} else {
-		toPush := make(map[string]Review)
-		toPush["reviews"] = review
-		toUpdate["$addToSet"] = toPush
+		toUpdate["$set"] = map[string]interface{}{
+			"updated_at": ts,
+		}
+		_, err := pr.Collection.UpdateOne(ctx, where, toUpdate)
+		return err
 	}
-	toUpdate["$set"] = map[string]interface{}{
-		"updated_at": ts,
+
+	// The review is upserted by its id: a review already recorded (e.g. on a redelivery) is replaced
+	result, err := pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":              prId,
+		"reviews.review_id": review.ReviewId,
+	}, map[string]interface{}{
+		"$set": map[string]interface{}{
+			"reviews.$":  review,
+			"updated_at": ts,
+		},
+	})
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+	_, err = pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":              prId,
+		"reviews.review_id": map[string]int64{"$ne": review.ReviewId},
+	}, map[string]interface{}{
+		"$push": map[string]Review{"reviews": review},
+		"$set": map[string]interface{}{
+			"updated_at": ts,
+		},
+	})
+	return err
+}
+
+// UpsertReviewThread records the review thread, replacing the one recorded with the same id
+func (pr *PR) UpsertReviewThread(prId int64, thread ReviewThread) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	result, err := pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":                     prId,
+		"review_threads.thread_id": thread.ThreadId,
+	}, map[string]interface{}{
+		"$set": map[string]interface{}{
+			"review_threads.$": thread,
+			"updated_at":       ts,
+		},
+	})
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+	return pr.AddReviewThread(prId, thread)
+}
+
+// AddReviewThread records the new review thread, unless a thread with the same id is already recorded
+func (pr *PR) AddReviewThread(prId int64, thread ReviewThread) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	_, err := pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":                     prId,
+		"review_threads.thread_id": map[string]int64{"$ne": thread.ThreadId},
+	}, map[string]interface{}{
+		"$push": map[string]ReviewThread{"review_threads": thread},
+		"$set": map[string]interface{}{
+			"updated_at": nudgeTime.NudgeTime().Unix(),
+		},
+	})
+	return err
+}
+
+// RecordReviewThreadReply records the time of the latest reply on the review thread. The replies on the threads
+// which are not recorded are ignored.
+func (pr *PR) RecordReviewThreadReply(prId int64, threadId int64, repliedAt int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	_, err := pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":                     prId,
+		"review_threads.thread_id": threadId,
+	}, map[string]interface{}{
+		"$max": map[string]int64{"review_threads.$.last_comment_at": repliedAt},
+		"$set": map[string]int64{"updated_at": nudgeTime.NudgeTime().Unix()},
+	})
+	return err
+}
+
+// DismissStaleApprovals dismisses the approvals of the PR submitted before the push (pushedAt), as the branch
+// protection does when it dismisses the stale approvals. Returns the number of approvals dismissed.
+func (pr *PR) DismissStaleApprovals(prId int64, pushedAt int64) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var current PRModel
+	err := pr.Collection.FindOne(ctx, map[string]int64{"prid": prId}, nil).Decode(&current)
+	if err != nil {
+		return 0, err
+	}
+	stale := len(StaleApprovals(current.Reviews, pushedAt))
+	if stale == 0 {
+		return 0, nil
+	}
+
+	nudgeTime := new(time2.NudgeTime)
+	_, err = pr.Collection.UpdateOne(ctx, map[string]int64{"prid": prId}, map[string]interface{}{
+		"$set": map[string]interface{}{
+			"reviews.$[stale].review_state": ReviewStateDismissed,
+			"updated_at":                    nudgeTime.NudgeTime().Unix(),
+		},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		map[string]interface{}{
+			"stale.review_state": "approved",
+			"stale.submitted_at": map[string]int64{"$lt": pushedAt},
+		},
+	}}))
+	if err != nil {
+		return 0, err
+	}
+	return stale, nil
+}
+
+// RecordReviewRequest records the request for the reviewer to review the PR, keeping the latest one
+func (pr *PR) RecordReviewRequest(prId int64, reviewer string, requestedAt int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	result, err := pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":                     prId,
+		"review_requests.reviewer": reviewer,
+	}, map[string]interface{}{
+		"$max": map[string]int64{"review_requests.$.requested_at": requestedAt},
+		"$set": map[string]int64{"updated_at": ts},
+	})
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+	_, err = pr.Collection.UpdateOne(ctx, map[string]interface{}{
+		"prid":                     prId,
+		"review_requests.reviewer": map[string]string{"$ne": reviewer},
+	}, map[string]interface{}{
+		"$push": map[string]ReviewRequest{"review_requests": {Reviewer: reviewer, RequestedAt: requestedAt}},
+		"$set":  map[string]int64{"updated_at": ts},
+	})
+	return err
+}
+
+// RemoveReviewRequest forgets the request for the reviewer to review the PR
+func (pr *PR) RemoveReviewRequest(prId int64, reviewer string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	_, err := pr.Collection.UpdateOne(ctx, map[string]int64{"prid": prId}, map[string]interface{}{
+		"$pull": map[string]interface{}{"review_requests": map[string]string{"reviewer": reviewer}},
+		"$set":  map[string]int64{"updated_at": nudgeTime.NudgeTime().Unix()},
+	})
+	return err
+}
+
+// UpdateLifeTime sets the predicted lifetime of the PR and appends the revision to its history. Nothing
+// is updated if the lifetime has not changed. Returns true if the lifetime was revised.
+func (pr *PR) UpdateLifeTime(prId int64, revision LifeTimeRevision) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]int64{
+		"prid": prId,
+	}
+	var current PRModel
+	err := pr.Collection.FindOne(ctx, where, nil).Decode(&current)
+	if err != nil {
+		return false, err
+	}
+	if current.LifeTime == revision.LifeTime {
+		return false, nil
+	}
+
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	revision.PreviousLifeTime = current.LifeTime
+	revision.RevisedAt = ts
+	toUpdate := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"life_time":  revision.LifeTime,
+			"updated_at": ts,
+		},
+		"$push": map[string]interface{}{
+			"life_time_revisions": revision,
+		},
+	}
+	_, err = pr.Collection.UpdateOne(ctx, where, toUpdate)
+	return err == nil, err
+}
+
+// RecordActivitySignal appends the signal to the PR, retaining only the most recent signals. The signal of a
+// webhook delivery is recorded once, however many times the delivery is processed.
+func (pr *PR) RecordActivitySignal(prId int64, signal ActivitySignal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]interface{}{
+		"prid": prId,
+	}
+	if len(signal.DeliveryId) > 0 {
+		where["activity_signals.delivery_id"] = map[string]string{"$ne": signal.DeliveryId}
+	}
+	nudgeTime := new(time2.NudgeTime)
+	toUpdate := map[string]interface{}{
+		"$push": map[string]interface{}{
+			"activity_signals": map[string]interface{}{
+				"$each":  []ActivitySignal{signal},
+				"$slice": -maxActivitySignals,
+			},
+		},
+		"$set": map[string]interface{}{
+			"updated_at": nudgeTime.NudgeTime().Unix(),
+		},
+	}
+	_, err := pr.Collection.UpdateOne(ctx, where, toUpdate)
+	return err
+}
+
+// FindByPRId returns the PR
+func (pr *PR) FindByPRId(prId int64) (*PRModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var result PRModel
+	err := pr.Collection.FindOne(ctx, map[string]int64{"prid": prId}, nil).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FindByNumber returns the PR of the repository with the PR number
+func (pr *PR) FindByNumber(repoId int64, number int) (*PRModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]interface{}{
+		"repo_id": repoId,
+		"number":  number,
+	}
+	var result PRModel
+	err := pr.Collection.FindOne(ctx, where, nil).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateCICheck records the state of the check on the open PRs of the repository whose head commit
+// is headSHA, and recomputes the CI state of those PRs. The checks of a commit are reported in bursts,
+// so the check is merged (as MergeCICheck does) and the state recomputed (as CIStateOf does) by the
+// update itself, for the concurrent updates not to overwrite each other.
+func (pr *PR) UpdateCICheck(repoId int64, headSHA string, check CICheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]interface{}{
+		"repo_id":  repoId,
+		"head_sha": headSHA,
+		"status":   "open",
+	}
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	checks := map[string]interface{}{"$ifNull": []interface{}{"$ci_checks", []interface{}{}}}
+	literal := map[string]interface{}{"$literal": check}
+	pipeline := []map[string]interface{}{
+		{"$set": map[string]interface{}{
+			"ci_checks": map[string]interface{}{"$cond": []interface{}{
+				map[string]interface{}{"$in": []interface{}{check.Name, map[string]interface{}{"$ifNull": []interface{}{"$ci_checks.name", []interface{}{}}}}},
+				map[string]interface{}{"$map": map[string]interface{}{
+					"input": checks,
+					"in": map[string]interface{}{"$cond": []interface{}{
+						map[string]interface{}{"$eq": []interface{}{"$$this.name", check.Name}}, literal, "$$this",
+					}},
+				}},
+				map[string]interface{}{"$concatArrays": []interface{}{checks, []interface{}{literal}}},
+			}},
+			"updated_at": ts,
+		}},
+		{"$set": map[string]interface{}{
+			"ci_state": map[string]interface{}{"$switch": map[string]interface{}{
+				"branches": []interface{}{
+					map[string]interface{}{"case": map[string]interface{}{"$in": []interface{}{CIStateFailure, "$ci_checks.state"}}, "then": CIStateFailure},
+					map[string]interface{}{"case": map[string]interface{}{"$in": []interface{}{CIStatePending, "$ci_checks.state"}}, "then": CIStatePending},
+				},
+				"default": CIStateSuccess,
+			}},
+		}},
+		// The CI is pending since the first pending check, the time is cleared once the CI is no longer pending
+		{"$set": map[string]interface{}{
+			"ci_pending_since": map[string]interface{}{"$cond": []interface{}{
+				map[string]interface{}{"$eq": []interface{}{"$ci_state", CIStatePending}},
+				map[string]interface{}{"$ifNull": []interface{}{"$ci_pending_since", ts}},
+				"$$REMOVE",
+			}},
+		}},
+	}
+	_, err := pr.Collection.UpdateMany(ctx, where, pipeline)
+	return err
+}
+
+// ResetCI sets the head commit of the PR, clearing the checks reported on the previous head commit. The checks
+// already reported on headSHA are kept.
+func (pr *PR) ResetCI(prId int64, headSHA string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]interface{}{
+		"prid":     prId,
+		"head_sha": map[string]string{"$ne": headSHA},
+	}
+	nudgeTime := new(time2.NudgeTime)
+	toUpdate := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"head_sha":   headSHA,
+			"updated_at": nudgeTime.NudgeTime().Unix(),
+		},
+		"$unset": map[string]interface{}{
+			"ci_checks":        "",
+			"ci_state":         "",
+			"ci_pending_since": "",
+		},
 	}
 	_, err := pr.Collection.UpdateOne(ctx, where, toUpdate)
 	return err
@@ -262,16 +746,88 @@ func (pr *PR) IncrementTotalCommentsMade(prId int64) error {
 	return err
 }
 
-func CreateDataModelForPR(pr github.PullRequest, repoId int64) *PRModel {
+// CreateReviewThread creates the review thread from the thread of the webhook event, resolved (or not) by
+// resolvedBy. Returns false if the thread has no comment.
+func CreateReviewThread(thread github.PullRequestThread, resolved bool, resolvedBy string) (ReviewThread, bool) {
+	if len(thread.Comments) == 0 || thread.Comments[0] == nil {
+		return ReviewThread{}, false
+	}
+	first := thread.Comments[0]
+	model := ReviewThread{
+		ThreadId: first.GetID(),
+		ReviewId: first.GetPullRequestReviewID(),
+		Author:   first.GetUser().GetLogin(),
+		Resolved: resolved,
+	}
+	if resolved && len(resolvedBy) > 0 {
+		model.ResolvedBy = &resolvedBy
+	}
+	for _, comment := range thread.Comments {
+		if comment == nil {
+			continue
+		}
+		if at := comment.GetCreatedAt().Unix(); comment.CreatedAt != nil && at > model.LastCommentAt {
+			model.LastCommentAt = at
+		}
+	}
+	return model, true
+}
+
+// StaleApprovals returns the approvals submitted before the push (pushedAt)
+func StaleApprovals(reviews *[]Review, pushedAt int64) []Review {
+	stale := make([]Review, 0)
+	if reviews == nil {
+		return stale
+	}
+	for _, review := range *reviews {
+		if review.ReviewState != nil && *review.ReviewState == "approved" && review.SubmittedAt != nil && *review.SubmittedAt < pushedAt {
+			stale = append(stale, review)
+		}
+	}
+	return stale
+}
+
+// onlyDuplicates returns true if the error of the unordered bulk insert is made of duplicate key errors alone
+func onlyDuplicates(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateDataModelForPR creates the PR record with lifeTime as the predicted lifetime (in hours)
+func CreateDataModelForPR(pr github.PullRequest, repoId int64, lifeTime int) *PRModel {
 	model := new(PRModel)
 	model.PRID = *pr.ID
 	model.Number = *pr.Number
 	model.RepoId = repoId
 	model.Status = *pr.State
 	model.Draft = pr.Draft
+	model.Title = pr.Title
+	if pr.User != nil {
+		model.Author = pr.User.Login
+	}
+	if pr.Head != nil {
+		model.HeadSHA = pr.Head.SHA
+	}
+	if len(pr.Labels) > 0 {
+		labels := make([]string, 0)
+		for _, l := range pr.Labels {
+			if l.Name != nil {
+				labels = append(labels, *l.Name)
+			}
+		}
+		model.Labels = &labels
+	}
 	model.PRCreatedAt = pr.CreatedAt.Unix()
 	model.PRUpdatedAt = pr.UpdatedAt.Unix()
-	model.LifeTime = prediction.EstimateLifeTime()
+	model.LifeTime = lifeTime
 	model.WorkflowState = WorkFlowStateActive
 	if len(pr.RequestedReviewers) > 0 {
 		reviewers := make([]string, 0)
@@ -282,6 +838,129 @@ func CreateDataModelForPR(pr github.PullRequest, repoId int64) *PRModel {
 		}
 		model.RequestedReviewers = &reviewers
 	}
+	if len(pr.RequestedTeams) > 0 {
+		teams := make([]string, 0)
+		for _, t := range pr.RequestedTeams {
+			if t.Slug != nil {
+				teams = append(teams, TeamHandle(pr.GetBase().GetRepo().GetOwner().GetLogin(), t))
+			}
+		}
+		model.RequestedTeams = &teams
+	}
 	// Update with the reviewers if there is any
 	return model
 }
+
+// CreateLifeTimeRevision creates the revision of the lifetime predicted for the PR on the webhook action
+func CreateLifeTimeRevision(pr github.PullRequest, lifeTime int, action string) LifeTimeRevision {
+	return LifeTimeRevision{
+		LifeTime:     lifeTime,
+		Action:       action,
+		LinesAdded:   pr.GetAdditions(),
+		LinesDeleted: pr.GetDeletions(),
+		FilesChanged: pr.GetChangedFiles(),
+		Commits:      pr.GetCommits(),
+	}
+}
+
+// MergeCICheck replaces the check of the same name in checks, or appends it if it is a new check
+func MergeCICheck(checks []CICheck, check CICheck) []CICheck {
+	merged := make([]CICheck, 0)
+	found := false
+	for _, c := range checks {
+		if c.Name == check.Name {
+			merged = append(merged, check)
+			found = true
+		} else {
+			merged = append(merged, c)
+		}
+	}
+	if !found {
+		merged = append(merged, check)
+	}
+	return merged
+}
+
+// CIStateOf returns the state of the CI from its checks. The CI is failing if any of the
+// checks failed, and pending if any of the remaining checks is yet to complete.
+func CIStateOf(checks []CICheck) string {
+	state := CIStateSuccess
+	for _, c := range checks {
+		if c.State == CIStateFailure {
+			return CIStateFailure
+		}
+		if c.State == CIStatePending {
+			state = CIStatePending
+		}
+	}
+	return state
+}
+
+// CheckRunState maps the status and conclusion of a check run (or check suite) to a CI state
+// https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
+func CheckRunState(status string, conclusion string) string {
+	if status != "completed" {
+		return CIStatePending
+	}
+	switch conclusion {
+	case "failure", "timed_out", "cancelled", "action_required", "startup_failure":
+		return CIStateFailure
+	default:
+		// success, neutral, skipped and stale
+		return CIStateSuccess
+	}
+}
+
+// CommitStatusState maps the state of a commit status to a CI state
+// https://docs.github.com/en/rest/commits/statuses?apiVersion=2022-11-28#create-a-commit-status
+func CommitStatusState(state string) string {
+	switch state {
+	case "pending":
+		return CIStatePending
+	case "failure", "error":
+		return CIStateFailure
+	default:
+		return CIStateSuccess
+	}
+}
+
+// TeamHandle returns the handle (org/team) of the team of the organization, as mentioned on GitHub
+func TeamHandle(org string, team *github.Team) string {
+	if team.Organization != nil && team.Organization.Login != nil {
+		org = *team.Organization.Login
+	}
+	return org + "/" + team.GetSlug()
+}
+
+// SnoozeDuration returns the duration of the snooze label (nudge-snooze-<n><h|d|w>), e.g. 3 days for
+// nudge-snooze-3d. Returns false if the label is not a snooze label.
+func SnoozeDuration(label string) (time.Duration, bool) {
+	spec, found := strings.CutPrefix(strings.ToLower(label), SnoozeLabelPrefix)
+	if !found {
+		return 0, false
+	}
+	return ParseSnoozeDuration(spec)
+}
+
+// ParseSnoozeDuration parses the duration of a snooze given as <n><h|d|w>, e.g. 3d for 3 days.
+// Returns false if the duration is invalid.
+func ParseSnoozeDuration(spec string) (time.Duration, bool) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if len(spec) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(spec[:len(spec)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	switch spec[len(spec)-1] {
+	case 'h':
+		return time.Duration(n) * time.Hour, true
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, true
+	case 'w':
+		return time.Duration(n) * 7 * 24 * time.Hour, true
+	default:
+		return 0, false
+	}
+}
@@ -2,13 +2,17 @@ package pr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/go-github/v52/github"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"log"
+	"nudge/internal/database"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -72,6 +76,62 @@ func TestPR_Create(t *testing.T) {
 	}
 }
 
+func TestPR_CreateIsIdempotent(t *testing.T) {
+	setUp()
+	defer tearDown()
+	database.SyncIndexes(dbTest, log.Default())
+
+	prRepo := Init(dbTest)
+	// Redelivered opened event
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+	assert.NoError(t, prRepo.BulkCreate([]*PRModel{
+		{Number: 1, PRID: 1, RepoId: 1, Status: "open"},
+		{Number: 2, PRID: 2, RepoId: 1, Status: "open"},
+	}))
+
+	prs, err := prRepo.GetOpenPRs(1)
+	assert.NoError(t, err)
+	assert.Len(t, *prs, 2)
+}
+
+func TestMigrateUniquePRId(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	collection := dbTest.Collection(database.PRCollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: map[string]int{"prid": 1}})
+	assert.NoError(t, err)
+
+	// The original record holds the reviews, the duplicate is the blank copy of a redelivered opened event
+	reviewState, reviewer := "approved", "alice"
+	original := &PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open", Reviews: &[]Review{{ReviewId: 1, ReviewState: &reviewState, Reviewer: &reviewer}}}
+	_, err = collection.InsertMany(ctx, []interface{}{original, &PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}})
+	assert.NoError(t, err)
+
+	database.SyncIndexes(dbTest, log.Default())
+
+	count, err := collection.CountDocuments(ctx, map[string]int64{"prid": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	prModel, err := Init(dbTest).FindByPRId(1)
+	assert.NoError(t, err)
+	assert.NotNil(t, prModel.Reviews)
+	assert.NoError(t, Init(dbTest).Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+	count, _ = collection.CountDocuments(ctx, map[string]int64{"prid": 1})
+	assert.Equal(t, int64(1), count)
+}
+
+func TestOnlyDuplicates(t *testing.T) {
+	duplicate := mongo.WriteError{Code: 11000}
+	assert.True(t, onlyDuplicates(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: duplicate}}}))
+	assert.False(t, onlyDuplicates(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: duplicate}, {WriteError: mongo.WriteError{Code: 121}}}}))
+	assert.False(t, onlyDuplicates(nil))
+	assert.False(t, onlyDuplicates(errors.New("timeout")))
+}
+
 func TestPR_BulkCreate(t *testing.T) {
 	setUp()
 	defer tearDown()
@@ -179,6 +239,137 @@ func TestPR_UpdateReview(t *testing.T) {
 	}
 }
 
+func TestPR_UpdateReviewIsIdempotent(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+
+	commented, approved, reviewer := "commented", "approved", "alice"
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 1, ReviewState: &commented, Reviewer: &reviewer}, false))
+	// Redelivered, then edited
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 1, ReviewState: &commented, Reviewer: &reviewer}, false))
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 1, ReviewState: &approved, Reviewer: &reviewer}, false))
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 2, ReviewState: &commented, Reviewer: &reviewer}, false))
+
+	prModel, err := prRepo.FindByPRId(1)
+	assert.NoError(t, err)
+	assert.Len(t, *prModel.Reviews, 2)
+	assert.Equal(t, approved, *(*prModel.Reviews)[0].ReviewState)
+}
+
+func TestCreateReviewThread(t *testing.T) {
+	first := github.Timestamp{Time: time.Unix(1700000000, 0)}
+	reply := github.Timestamp{Time: time.Unix(1700000600, 0)}
+	thread := github.PullRequestThread{Comments: []*github.PullRequestComment{
+		{ID: github.Int64(10), PullRequestReviewID: github.Int64(3), User: &github.User{Login: github.String("bob")}, CreatedAt: &first},
+		{ID: github.Int64(11), PullRequestReviewID: github.Int64(4), User: &github.User{Login: github.String("alice")}, CreatedAt: &reply},
+	}}
+
+	model, valid := CreateReviewThread(thread, true, "alice")
+	assert.True(t, valid)
+	resolvedBy := "alice"
+	assert.Equal(t, ReviewThread{ThreadId: 10, ReviewId: 3, Author: "bob", Resolved: true, ResolvedBy: &resolvedBy, LastCommentAt: reply.Unix()}, model)
+
+	model, _ = CreateReviewThread(thread, false, "alice")
+	assert.False(t, model.Resolved)
+	assert.Nil(t, model.ResolvedBy)
+
+	_, valid = CreateReviewThread(github.PullRequestThread{}, true, "alice")
+	assert.False(t, valid)
+}
+
+func TestPR_UpsertReviewThread(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+
+	assert.NoError(t, prRepo.AddReviewThread(1, ReviewThread{ThreadId: 10, ReviewId: 3, Author: "bob", LastCommentAt: 100}))
+	// Redelivered
+	assert.NoError(t, prRepo.AddReviewThread(1, ReviewThread{ThreadId: 10, ReviewId: 3, Author: "bob", LastCommentAt: 100}))
+	assert.NoError(t, prRepo.AddReviewThread(1, ReviewThread{ThreadId: 20, ReviewId: 3, Author: "bob", LastCommentAt: 100}))
+	assert.NoError(t, prRepo.RecordReviewThreadReply(1, 10, 200))
+	// Delivered out of order
+	assert.NoError(t, prRepo.RecordReviewThreadReply(1, 10, 150))
+
+	resolvedBy := "alice"
+	assert.NoError(t, prRepo.UpsertReviewThread(1, ReviewThread{ThreadId: 20, ReviewId: 3, Author: "bob", Resolved: true, ResolvedBy: &resolvedBy, LastCommentAt: 100}))
+
+	prModel, err := prRepo.FindByPRId(1)
+	assert.NoError(t, err)
+	assert.Len(t, *prModel.ReviewThreads, 2)
+	assert.Equal(t, int64(200), (*prModel.ReviewThreads)[0].LastCommentAt)
+	assert.False(t, (*prModel.ReviewThreads)[0].Resolved)
+	assert.True(t, (*prModel.ReviewThreads)[1].Resolved)
+	assert.Equal(t, &resolvedBy, (*prModel.ReviewThreads)[1].ResolvedBy)
+}
+
+func TestPR_RecordReviewRequest(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+
+	assert.NoError(t, prRepo.RecordReviewRequest(1, "alice", 100))
+	assert.NoError(t, prRepo.RecordReviewRequest(1, "alice", 200))
+	// Delivered out of order
+	assert.NoError(t, prRepo.RecordReviewRequest(1, "alice", 150))
+	assert.NoError(t, prRepo.RecordReviewRequest(1, "bob", 100))
+
+	prModel, err := prRepo.FindByPRId(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ReviewRequest{{Reviewer: "alice", RequestedAt: 200}, {Reviewer: "bob", RequestedAt: 100}}, *prModel.ReviewRequests)
+
+	assert.NoError(t, prRepo.RemoveReviewRequest(1, "alice"))
+	prModel, err = prRepo.FindByPRId(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ReviewRequest{{Reviewer: "bob", RequestedAt: 100}}, *prModel.ReviewRequests)
+}
+
+func TestStaleApprovals(t *testing.T) {
+	approved, changesRequested := "approved", "changes_requested"
+	before, after := int64(100), int64(300)
+	reviews := []Review{
+		{ReviewId: 1, ReviewState: &approved, SubmittedAt: &before},
+		{ReviewId: 2, ReviewState: &changesRequested, SubmittedAt: &before},
+		{ReviewId: 3, ReviewState: &approved, SubmittedAt: &after},
+	}
+	stale := StaleApprovals(&reviews, 200)
+	assert.Len(t, stale, 1)
+	assert.Equal(t, int64(1), stale[0].ReviewId)
+	assert.Empty(t, StaleApprovals(nil, 200))
+}
+
+func TestPR_DismissStaleApprovals(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	assert.NoError(t, prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"}))
+
+	approved, reviewer := "approved", "alice"
+	before, after := int64(100), int64(300)
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 1, ReviewState: &approved, Reviewer: &reviewer, SubmittedAt: &before}, false))
+	assert.NoError(t, prRepo.UpdateReview(1, Review{ReviewId: 2, ReviewState: &approved, Reviewer: &reviewer, SubmittedAt: &after}, false))
+
+	dismissed, err := prRepo.DismissStaleApprovals(1, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dismissed)
+	// Redelivered
+	dismissed, err = prRepo.DismissStaleApprovals(1, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dismissed)
+
+	prModel, err := prRepo.FindByPRId(1)
+	assert.NoError(t, err)
+	assert.Equal(t, ReviewStateDismissed, *(*prModel.Reviews)[0].ReviewState)
+	assert.Equal(t, approved, *(*prModel.Reviews)[1].ReviewState)
+}
+
 func TestPR_Upsert(t *testing.T) {
 	setUp()
 	defer tearDown()
@@ -245,15 +436,109 @@ func TestCreateDataModelForPR(t *testing.T) {
 		UpdatedAt: &github.Timestamp{Time: exampleUpdatedAt},
 	}
 
-	prModel := CreateDataModelForPR(*ghPr, 1)
+	prModel := CreateDataModelForPR(*ghPr, 1, 5)
 
 	if prModel.PRID != *ghPr.ID || prModel.Number != *ghPr.Number ||
-		prModel.RepoId != 1 || prModel.Status != *ghPr.State ||
+		prModel.RepoId != 1 || prModel.Status != *ghPr.State || prModel.LifeTime != 5 ||
 		prModel.PRCreatedAt != ghPr.CreatedAt.Unix() || prModel.PRUpdatedAt != ghPr.UpdatedAt.Unix() {
 		t.Errorf("CreateDataModelForPR did not create the correct PRModel")
 	}
 }
 
+func TestPR_UpdateLifeTime(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{PRID: 1, RepoId: 1, Status: "open", LifeTime: 4})
+	if err != nil {
+		t.Fatalf("Cannot create PR: %v", err)
+	}
+
+	revised, err := prRepo.UpdateLifeTime(1, LifeTimeRevision{LifeTime: 4, Action: "edited"})
+	assert.NoError(t, err)
+	assert.False(t, revised)
+
+	revised, err = prRepo.UpdateLifeTime(1, LifeTimeRevision{LifeTime: 40, Action: "synchronize", LinesAdded: 2000})
+	assert.NoError(t, err)
+	assert.True(t, revised)
+
+	var updatedPR PRModel
+	err = prRepo.Collection.FindOne(context.Background(), map[string]interface{}{"prid": 1}).Decode(&updatedPR)
+	if err != nil {
+		t.Fatal("Failed to retrieve updated PRModel:", err)
+	}
+	assert.Equal(t, 40, updatedPR.LifeTime)
+	assert.Len(t, *updatedPR.LifeTimeRevisions, 1)
+	assert.Equal(t, 4, (*updatedPR.LifeTimeRevisions)[0].PreviousLifeTime)
+	assert.Equal(t, "synchronize", (*updatedPR.LifeTimeRevisions)[0].Action)
+	assert.Equal(t, 2000, (*updatedPR.LifeTimeRevisions)[0].LinesAdded)
+
+	_, err = prRepo.UpdateLifeTime(2, LifeTimeRevision{LifeTime: 4})
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func TestPR_RecordActivitySignal(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{PRID: 1, RepoId: 1, Number: 7, Status: "open"})
+	if err != nil {
+		t.Fatalf("Cannot create PR: %v", err)
+	}
+
+	for i := 0; i < maxActivitySignals+5; i++ {
+		err = prRepo.RecordActivitySignal(1, ActivitySignal{Signal: SignalComment, Actor: "foo", OccurredAt: int64(i)})
+		assert.NoError(t, err)
+	}
+
+	updatedPR, err := prRepo.FindByNumber(1, 7)
+	if err != nil {
+		t.Fatal("Failed to retrieve updated PRModel:", err)
+	}
+	assert.Len(t, *updatedPR.ActivitySignals, maxActivitySignals)
+	// Only the most recent signals are retained
+	assert.Equal(t, int64(5), (*updatedPR.ActivitySignals)[0].OccurredAt)
+	assert.Equal(t, int64(maxActivitySignals+4), (*updatedPR.ActivitySignals)[maxActivitySignals-1].OccurredAt)
+
+	_, err = prRepo.FindByNumber(1, 8)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	// Retried delivery
+	assert.NoError(t, prRepo.RecordActivitySignal(1, ActivitySignal{Signal: SignalReview, Actor: "bar", DeliveryId: "d1"}))
+	assert.NoError(t, prRepo.RecordActivitySignal(1, ActivitySignal{Signal: SignalReview, Actor: "bar", DeliveryId: "d1"}))
+	updatedPR, _ = prRepo.FindByNumber(1, 7)
+	assert.Len(t, *updatedPR.ActivitySignals, maxActivitySignals)
+	assert.Equal(t, "d1", (*updatedPR.ActivitySignals)[maxActivitySignals-1].DeliveryId)
+	assert.Equal(t, int64(maxActivitySignals+4), (*updatedPR.ActivitySignals)[maxActivitySignals-2].OccurredAt)
+}
+
+func TestPR_RecordActivitySignalOfOpenedPR(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	opened := ActivitySignal{Signal: SignalStateChange, Action: "opened", Actor: "foo", DeliveryId: "d1"}
+
+	// The signal of a PR which is not recorded yet is lost
+	assert.NoError(t, prRepo.RecordActivitySignal(1, opened))
+	assert.NoError(t, prRepo.Create(&PRModel{PRID: 1, RepoId: 1, Number: 7, Status: "open"}))
+	createdPR, err := prRepo.FindByNumber(1, 7)
+	if err != nil {
+		t.Fatal("Failed to retrieve the created PRModel:", err)
+	}
+	assert.Nil(t, createdPR.ActivitySignals)
+
+	// Recorded once the PR is created, as the webhook does on opened
+	assert.NoError(t, prRepo.RecordActivitySignal(1, opened))
+	createdPR, _ = prRepo.FindByNumber(1, 7)
+	if assert.NotNil(t, createdPR.ActivitySignals) && assert.Len(t, *createdPR.ActivitySignals, 1) {
+		assert.Equal(t, "opened", (*createdPR.ActivitySignals)[0].Action)
+		assert.Equal(t, SignalStateChange, (*createdPR.ActivitySignals)[0].Signal)
+	}
+}
+
 func TestIncrementTotalCommentsMade(t *testing.T) {
 	setUp()
 	defer tearDown()
@@ -331,3 +616,247 @@ func TestIncrementTotalCommentsMade(t *testing.T) {
 		})
 	}
 }
+
+func TestCIStateOf(t *testing.T) {
+	testCases := []struct {
+		description string
+		checks      []CICheck
+		expected    string
+	}{
+		{"no checks", []CICheck{}, CIStateSuccess},
+		{"all passed", []CICheck{{Name: "build", State: CIStateSuccess}, {Name: "lint", State: CIStateSuccess}}, CIStateSuccess},
+		{"one running", []CICheck{{Name: "build", State: CIStateSuccess}, {Name: "lint", State: CIStatePending}}, CIStatePending},
+		{"one failed", []CICheck{{Name: "build", State: CIStatePending}, {Name: "lint", State: CIStateFailure}}, CIStateFailure},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, CIStateOf(tc.checks))
+		})
+	}
+}
+
+func TestMergeCICheck(t *testing.T) {
+	checks := MergeCICheck([]CICheck{}, CICheck{Name: "build", State: CIStatePending})
+	checks = MergeCICheck(checks, CICheck{Name: "lint", State: CIStatePending})
+	checks = MergeCICheck(checks, CICheck{Name: "build", State: CIStateFailure})
+
+	assert.Equal(t, []CICheck{{Name: "build", State: CIStateFailure}, {Name: "lint", State: CIStatePending}}, checks)
+}
+
+func TestCheckRunState(t *testing.T) {
+	assert.Equal(t, CIStatePending, CheckRunState("queued", ""))
+	assert.Equal(t, CIStatePending, CheckRunState("in_progress", ""))
+	assert.Equal(t, CIStateSuccess, CheckRunState("completed", "success"))
+	assert.Equal(t, CIStateSuccess, CheckRunState("completed", "skipped"))
+	assert.Equal(t, CIStateFailure, CheckRunState("completed", "failure"))
+	assert.Equal(t, CIStateFailure, CheckRunState("completed", "timed_out"))
+}
+
+func TestCommitStatusState(t *testing.T) {
+	assert.Equal(t, CIStatePending, CommitStatusState("pending"))
+	assert.Equal(t, CIStateSuccess, CommitStatusState("success"))
+	assert.Equal(t, CIStateFailure, CommitStatusState("failure"))
+	assert.Equal(t, CIStateFailure, CommitStatusState("error"))
+}
+
+func TestPR_UpdateCICheck(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	headSHA := "abc"
+	err := prRepo.Create(&PRModel{PRID: 1, RepoId: 1, Number: 1, Status: "open", HeadSHA: &headSHA})
+	if err != nil {
+		t.Fatalf("Cannot create PR: %v", err)
+	}
+
+	err = prRepo.UpdateCICheck(1, headSHA, CICheck{Name: "build", State: CIStatePending})
+	assert.NoError(t, err)
+	updatedPR, err := prRepo.FindByNumber(1, 1)
+	if err != nil {
+		t.Fatal("Failed to retrieve updated PRModel:", err)
+	}
+	assert.Equal(t, CIStatePending, *updatedPR.CIState)
+	assert.NotNil(t, updatedPR.CIPendingSince)
+
+	err = prRepo.UpdateCICheck(1, headSHA, CICheck{Name: "build", State: CIStateFailure})
+	assert.NoError(t, err)
+	updatedPR, _ = prRepo.FindByNumber(1, 1)
+	assert.Equal(t, CIStateFailure, *updatedPR.CIState)
+	assert.Nil(t, updatedPR.CIPendingSince)
+	assert.Len(t, *updatedPR.CIChecks, 1)
+
+	err = prRepo.ResetCI(1, "def")
+	assert.NoError(t, err)
+	updatedPR, _ = prRepo.FindByNumber(1, 1)
+	assert.Equal(t, "def", *updatedPR.HeadSHA)
+	assert.Nil(t, updatedPR.CIState)
+	assert.Nil(t, updatedPR.CIChecks)
+
+	// The retried synchronize event keeps the checks already reported on the new head commit
+	assert.NoError(t, prRepo.UpdateCICheck(1, "def", CICheck{Name: "build", State: CIStateSuccess}))
+	assert.NoError(t, prRepo.ResetCI(1, "def"))
+	updatedPR, _ = prRepo.FindByNumber(1, 1)
+	assert.Len(t, *updatedPR.CIChecks, 1)
+}
+
+func TestPR_UpdateCICheckConcurrently(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	headSHA := "abc"
+	assert.NoError(t, prRepo.Create(&PRModel{PRID: 1, RepoId: 1, Number: 1, Status: "open", HeadSHA: &headSHA}))
+	assert.NoError(t, prRepo.UpdateCICheck(1, headSHA, CICheck{Name: "build", State: CIStatePending}))
+
+	// The checks of a commit are reported at once, and processed by several workers
+	var wg sync.WaitGroup
+	for _, check := range []CICheck{{Name: "build", State: CIStateSuccess}, {Name: "lint", State: CIStateFailure}} {
+		wg.Add(1)
+		go func(check CICheck) {
+			defer wg.Done()
+			assert.NoError(t, prRepo.UpdateCICheck(1, headSHA, check))
+		}(check)
+	}
+	wg.Wait()
+
+	updatedPR, err := prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []CICheck{{Name: "build", State: CIStateSuccess}, {Name: "lint", State: CIStateFailure}}, *updatedPR.CIChecks)
+	assert.Equal(t, CIStateFailure, *updatedPR.CIState)
+	assert.Nil(t, updatedPR.CIPendingSince)
+}
+
+func TestTeamHandle(t *testing.T) {
+	assert.Equal(t, "acme/backend", TeamHandle("acme", &github.Team{Slug: github.String("backend")}))
+	assert.Equal(t, "other/backend", TeamHandle("acme", &github.Team{
+		Slug:         github.String("backend"),
+		Organization: &github.Organization{Login: github.String("other")},
+	}))
+}
+
+func TestCreateDataModelForPRWithTeams(t *testing.T) {
+	ghPr := github.PullRequest{
+		ID:             github.Int64(1),
+		Number:         github.Int(1),
+		State:          github.String("open"),
+		CreatedAt:      &github.Timestamp{Time: time.Now()},
+		UpdatedAt:      &github.Timestamp{Time: time.Now()},
+		Base:           &github.PullRequestBranch{Repo: &github.Repository{Owner: &github.User{Login: github.String("acme")}}},
+		RequestedTeams: []*github.Team{{Slug: github.String("backend")}, {Slug: github.String("infra")}},
+	}
+
+	prModel := CreateDataModelForPR(ghPr, 1, 5)
+	assert.Equal(t, []string{"acme/backend", "acme/infra"}, *prModel.RequestedTeams)
+	assert.Nil(t, prModel.RequestedReviewers)
+}
+
+func TestCreateDataModelForPRWithLabels(t *testing.T) {
+	ghPr := github.PullRequest{
+		ID:        github.Int64(1),
+		Number:    github.Int(1),
+		State:     github.String("open"),
+		CreatedAt: &github.Timestamp{Time: time.Now()},
+		UpdatedAt: &github.Timestamp{Time: time.Now()},
+		Labels:    []*github.Label{{Name: github.String("wip")}, {Name: github.String("backend")}},
+	}
+
+	prModel := CreateDataModelForPR(ghPr, 1, 5)
+	assert.Equal(t, []string{"wip", "backend"}, *prModel.Labels)
+}
+
+func TestPR_UpdateLabel(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, prRepo.UpdateLabel(1, "on-hold", false))
+	assert.NoError(t, prRepo.UpdateLabel(1, "backend", false))
+	assert.NoError(t, prRepo.UpdateLabel(1, "on-hold", true))
+
+	prModel, err := prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backend"}, *prModel.Labels)
+}
+
+func TestPR_UpdateSnooze(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"})
+	assert.NoError(t, err)
+
+	until := time.Now().Add(72 * time.Hour).Unix()
+	assert.NoError(t, prRepo.UpdateSnooze(1, &until))
+	prModel, err := prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, until, *prModel.SnoozedUntil)
+
+	assert.NoError(t, prRepo.UpdateSnooze(1, nil))
+	prModel, err = prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, prModel.SnoozedUntil)
+}
+
+func TestSnoozeDuration(t *testing.T) {
+	testCases := []struct {
+		label    string
+		duration time.Duration
+		snooze   bool
+	}{
+		{"nudge-snooze-3d", 72 * time.Hour, true},
+		{"Nudge-Snooze-12h", 12 * time.Hour, true},
+		{"nudge-snooze-1w", 7 * 24 * time.Hour, true},
+		{"nudge-snooze-0d", 0, false},
+		{"nudge-snooze-3m", 0, false},
+		{"nudge-snooze-d", 0, false},
+		{"on-hold", 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			duration, snooze := SnoozeDuration(tc.label)
+			assert.Equal(t, tc.snooze, snooze)
+			assert.Equal(t, tc.duration, duration)
+		})
+	}
+}
+
+func TestPR_UpdateNudgeDisabled(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{Number: 1, PRID: 1, RepoId: 1, Status: "open"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, prRepo.UpdateNudgeDisabled(1, true))
+	prModel, err := prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.True(t, *prModel.NudgeDisabled)
+
+	assert.NoError(t, prRepo.UpdateNudgeDisabled(1, false))
+	prModel, err = prRepo.FindByNumber(1, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, prModel.NudgeDisabled)
+}
+
+func TestPR_FindByPRId(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	prRepo := Init(dbTest)
+	err := prRepo.Create(&PRModel{Number: 7, PRID: 42, RepoId: 1, Status: "open"})
+	assert.NoError(t, err)
+
+	prModel, err := prRepo.FindByPRId(42)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, prModel.Number)
+
+	_, err = prRepo.FindByPRId(43)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
@@ -14,8 +14,12 @@ type RepoModel struct {
 	RepoId         int64  `bson:"repo_id" json:"repo_id"`
 	Name           string `bson:"name" json:"name"`
 	Owner          string `bson:"owner" json:"owner"`
-	CreatedAt      int64  `bson:"created_at" json:"created_at"`
-	UpdatedAt      int64  `bson:"updated_at" json:"updated_at"`
+	// Config is the content of the configuration file of the repository (.github/nudge.yml), cached
+	// from its default branch. Empty if the repository has no configuration file.
+	Config          *string `bson:"config,omitempty" json:"config,omitempty"`
+	ConfigFetchedAt *int64  `bson:"config_fetched_at,omitempty" json:"config_fetched_at,omitempty"`
+	CreatedAt       int64   `bson:"created_at" json:"created_at"`
+	UpdatedAt       int64   `bson:"updated_at" json:"updated_at"`
 }
 
 type Repository struct {
@@ -89,6 +93,21 @@ func (repo *Repository) DeleteOneById(repoId int64) error {
 	return err
 }
 
+// FindByRepoId returns the repository
+func (repo *Repository) FindByRepoId(repoId int64) (*RepoModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	where := map[string]int64{
+		"repo_id": repoId,
+	}
+
+	var result RepoModel
+	if err := repo.Collection.FindOne(ctx, where, nil).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (repo *Repository) FindInstallationId(repoId int64) (*int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -105,3 +124,21 @@ func (repo *Repository) FindInstallationId(repoId int64) (*int64, error) {
 
 	return &Repo.InstallationId, nil
 }
+
+// UpdateConfig caches the content of the configuration file of the repository. A nil content only
+// records the fetch, and keeps the cached configuration.
+func (repo *Repository) UpdateConfig(repoId int64, content *string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	set := bson.M{
+		"config_fetched_at": ts,
+		"updated_at":        ts,
+	}
+	if content != nil {
+		set["config"] = *content
+	}
+	_, err := repo.Collection.UpdateOne(ctx, bson.M{"repo_id": repoId}, bson.M{"$set": set})
+	return err
+}
@@ -256,3 +256,39 @@ func TestFindInstallationId(t *testing.T) {
 		})
 	}
 }
+
+func TestRepository_UpdateConfig(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	repo := Init(dbTest)
+	err := repo.Create([]RepoModel{{InstallationId: 1, RepoId: 1, Name: "test-repo-1", Owner: "test-owner"}})
+	assert.NoError(t, err)
+
+	config := "follow_up_threshold_comments: 2"
+	assert.NoError(t, repo.UpdateConfig(1, &config))
+	// Recording the fetch keeps the cached configuration
+	assert.NoError(t, repo.UpdateConfig(1, nil))
+
+	repos, err := repo.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, *repos, 1)
+	assert.Equal(t, config, *(*repos)[0].Config)
+	assert.NotNil(t, (*repos)[0].ConfigFetchedAt)
+}
+
+func TestRepository_FindByRepoId(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	repo := Init(dbTest)
+	err := repo.Create([]RepoModel{{InstallationId: 1, RepoId: 1, Name: "test-repo-1", Owner: "test-owner"}})
+	assert.NoError(t, err)
+
+	found, err := repo.FindByRepoId(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-repo-1", found.Name)
+
+	_, err = repo.FindByRepoId(2)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
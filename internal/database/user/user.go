@@ -48,6 +48,22 @@ type GithubSlackMapping struct {
 	GitHubUsername string `bson:"git_hub_username" json:"git_hub_username"`
 	SlackUserId    string `bson:"slack_user_id" json:"slack_user_id"`
 }
+
+// GitHubUsernameOf returns the GitHub user mapped to the Slack user of the installation
+func (u UserModel) GitHubUsernameOf(slackUserId string) (string, bool) {
+	if u.GithubSlackMapping != nil {
+		for _, m := range *u.GithubSlackMapping {
+			if m.SlackUserId == slackUserId {
+				return m.GitHubUsername, true
+			}
+		}
+	}
+	if u.SlackUserId != nil && *u.SlackUserId == slackUserId {
+		return u.GitHubUsername, true
+	}
+	return "", false
+}
+
 type User struct {
 	Collection *mongo.Collection
 }
@@ -364,3 +364,25 @@ func TestFindUserTimezoneByInstallationId(t *testing.T) {
 func TimezonePtr(s TimeZone) *TimeZone {
 	return &s
 }
+
+func TestUserModel_GitHubUsernameOf(t *testing.T) {
+	rootSlackUserId := "U0ROOT"
+	u := UserModel{
+		GitHubUsername: "root",
+		SlackUserId:    &rootSlackUserId,
+		GithubSlackMapping: &[]GithubSlackMapping{
+			{GitHubUsername: "alice", SlackUserId: "U0ALICE"},
+		},
+	}
+
+	username, found := u.GitHubUsernameOf("U0ALICE")
+	assert.True(t, found)
+	assert.Equal(t, "alice", username)
+
+	username, found = u.GitHubUsernameOf("U0ROOT")
+	assert.True(t, found)
+	assert.Equal(t, "root", username)
+
+	_, found = u.GitHubUsernameOf("U0BOB")
+	assert.False(t, found)
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nudge/internal/database"
+	time2 "nudge/internal/time"
+	"time"
+)
+
+// LeaseDuration is how long a claimed delivery is held by its worker. A delivery whose worker died (e.g. on a
+// restart) is claimed again once its lease expires.
+const LeaseDuration = 10 * time.Minute
+
+// DeliveryModel is a webhook delivery of GitHub, queued until it is processed
+type DeliveryModel struct {
+	// DeliveryId is the X-GitHub-Delivery of the delivery
+	DeliveryId string `json:"delivery_id" bson:"delivery_id"`
+	// Event is the X-GitHub-Event of the delivery
+	Event   string `json:"event" bson:"event"`
+	Payload string `json:"payload" bson:"payload"`
+	// Attempts is the number of times the delivery has been claimed
+	Attempts      int     `json:"attempts" bson:"attempts"`
+	NextAttemptAt int64   `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   int64   `json:"locked_until" bson:"locked_until"`
+	LastError     *string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt     int64   `json:"created_at" bson:"created_at"`
+	UpdatedAt     int64   `json:"updated_at" bson:"updated_at"`
+}
+
+// ProcessedDeliveryModel is a processed webhook delivery, remembered for database.WebhookDeliveryTTL
+type ProcessedDeliveryModel struct {
+	DeliveryId string `json:"delivery_id" bson:"delivery_id"`
+	Event      string `json:"event" bson:"event"`
+	// ProcessedAt is a date, rather than a unix timestamp, for the TTL index to expire the record
+	ProcessedAt time.Time `json:"processed_at" bson:"processed_at"`
+}
+
+type Queue struct {
+	Collection  *mongo.Collection
+	DeadLetters *mongo.Collection
+	Processed   *mongo.Collection
+}
+
+func Init(db *mongo.Database) *Queue {
+	return &Queue{
+		Collection:  db.Collection(database.WebhookQueueCollection),
+		DeadLetters: db.Collection(database.WebhookDeadLetterCollection),
+		Processed:   db.Collection(database.WebhookDeliveryCollection),
+	}
+}
+
+// Enqueue persists the delivery, to be processed as soon as possible. A delivery already queued
+// (e.g. redelivered by GitHub) is not queued again.
+func (q *Queue) Enqueue(deliveryId, event string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	ts := nudgeTime.NudgeTime().Unix()
+	_, err := q.Collection.InsertOne(ctx, DeliveryModel{
+		DeliveryId:    deliveryId,
+		Event:         event,
+		Payload:       string(payload),
+		NextAttemptAt: ts,
+		CreatedAt:     ts,
+		UpdatedAt:     ts,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// Claim leases the next delivery due at the time, and counts the attempt. Returns nil when no delivery is due.
+func (q *Queue) Claim(now time.Time) (*DeliveryModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]interface{}{
+		"next_attempt_at": map[string]int64{"$lte": now.Unix()},
+		"locked_until":    map[string]int64{"$lte": now.Unix()},
+	}
+	update := map[string]interface{}{
+		"$set": map[string]int64{
+			"locked_until": now.Add(LeaseDuration).Unix(),
+			"updated_at":   now.Unix(),
+		},
+		"$inc": map[string]int{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(map[string]int{"next_attempt_at": 1}).
+		SetReturnDocument(options.After)
+
+	var delivery DeliveryModel
+	err := q.Collection.FindOneAndUpdate(ctx, where, update, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Complete records the delivery as processed, and removes it from the queue
+func (q *Queue) Complete(delivery DeliveryModel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	where := map[string]string{"delivery_id": delivery.DeliveryId}
+	processed := ProcessedDeliveryModel{
+		DeliveryId:  delivery.DeliveryId,
+		Event:       delivery.Event,
+		ProcessedAt: *nudgeTime.NudgeTime(),
+	}
+	_, err := q.Processed.ReplaceOne(ctx, where, processed, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = q.Collection.DeleteOne(ctx, where)
+	return err
+}
+
+// IsProcessed returns true if the delivery has been processed within database.WebhookDeliveryTTL
+func (q *Queue) IsProcessed(deliveryId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := q.Processed.CountDocuments(ctx, map[string]string{"delivery_id": deliveryId})
+	return count > 0, err
+}
+
+// Retry releases the failed delivery, to be claimed again at the time of its next attempt
+func (q *Queue) Retry(deliveryId string, nextAttemptAt time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	update := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"next_attempt_at": nextAttemptAt.Unix(),
+			"locked_until":    0,
+			"last_error":      lastError,
+			"updated_at":      nudgeTime.NudgeTime().Unix(),
+		},
+	}
+	_, err := q.Collection.UpdateOne(ctx, map[string]string{"delivery_id": deliveryId}, update)
+	return err
+}
+
+// DeadLetter moves the delivery, which failed all its attempts, to the dead letters
+func (q *Queue) DeadLetter(delivery DeliveryModel, lastError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	nudgeTime := new(time2.NudgeTime)
+	delivery.LastError = &lastError
+	delivery.LockedUntil = 0
+	delivery.UpdatedAt = nudgeTime.NudgeTime().Unix()
+	where := map[string]string{"delivery_id": delivery.DeliveryId}
+	_, err := q.DeadLetters.ReplaceOne(ctx, where, delivery, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = q.Collection.DeleteOne(ctx, where)
+	return err
+}
+
+// FindDeadLetters returns the dead letters, ordered by the time they were first queued
+func (q *Queue) FindDeadLetters() ([]DeliveryModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := q.DeadLetters.Find(ctx, map[string]interface{}{}, options.Find().SetSort(map[string]int{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]DeliveryModel, 0)
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Replay moves the dead letter back to the queue, with its attempts reset
+func (q *Queue) Replay(deliveryId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where := map[string]string{"delivery_id": deliveryId}
+	var delivery DeliveryModel
+	if err := q.DeadLetters.FindOne(ctx, where).Decode(&delivery); err != nil {
+		return err
+	}
+	nudgeTime := new(time2.NudgeTime)
+	delivery.Attempts = 0
+	delivery.LockedUntil = 0
+	delivery.NextAttemptAt = nudgeTime.NudgeTime().Unix()
+	delivery.UpdatedAt = delivery.NextAttemptAt
+	_, err := q.Collection.ReplaceOne(ctx, where, delivery, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = q.DeadLetters.DeleteOne(ctx, where)
+	return err
+}
+
+// Backoff returns the delay before retrying a delivery after its failed attempt (1 for the first attempt):
+// the base delay, doubled on every attempt, up to the max delay
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
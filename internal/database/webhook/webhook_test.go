@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"log"
+	"nudge/internal/database"
+	"os"
+	"testing"
+	"time"
+)
+
+var dbTest *mongo.Database
+
+// setUp is called to initialize the test database.
+func setUp() {
+	mongodbURI := os.Getenv("MONGODB_URI_TEST")
+	if mongodbURI == "" {
+		mongodbURI = "mongodb://localhost:27017/test_webhook" // Replace with your MongoDB test instance URI
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongodbURI))
+	if err != nil {
+		fmt.Println("Cannot create Mongo client", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		fmt.Println("Cannot connect to Mongo", err)
+		os.Exit(1)
+	}
+
+	err = client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		fmt.Println("Cannot ping Mongo", err)
+		os.Exit(1)
+	}
+
+	dbTest = client.Database("test_webhook") // Replace 'test_webhook' with your test database name
+	// The unique index on the delivery id drops the redeliveries
+	database.SyncIndexes(dbTest, log.Default())
+}
+
+// tearDown is called to clean up the test database.
+func tearDown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = dbTest.Drop(ctx)
+}
+
+func TestQueue_EnqueueAndClaim(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	q := Init(dbTest)
+	assert.NoError(t, q.Enqueue("d1", "pull_request", []byte(`{"action":"opened"}`)))
+	// Redelivered by GitHub
+	assert.NoError(t, q.Enqueue("d1", "pull_request", []byte(`{"action":"opened"}`)))
+
+	now := time.Now()
+	delivery, err := q.Claim(now)
+	assert.NoError(t, err)
+	assert.Equal(t, "d1", delivery.DeliveryId)
+	assert.Equal(t, "pull_request", delivery.Event)
+	assert.Equal(t, 1, delivery.Attempts)
+
+	// Leased to the first worker
+	delivery, err = q.Claim(now)
+	assert.NoError(t, err)
+	assert.Nil(t, delivery)
+
+	// Claimed again once the lease of a dead worker expires
+	delivery, err = q.Claim(now.Add(LeaseDuration + time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivery.Attempts)
+
+	processed, err := q.IsProcessed("d1")
+	assert.NoError(t, err)
+	assert.False(t, processed)
+
+	assert.NoError(t, q.Complete(*delivery))
+	delivery, err = q.Claim(now.Add(2 * LeaseDuration))
+	assert.NoError(t, err)
+	assert.Nil(t, delivery)
+	processed, err = q.IsProcessed("d1")
+	assert.NoError(t, err)
+	assert.True(t, processed)
+}
+
+func TestQueue_Retry(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	q := Init(dbTest)
+	assert.NoError(t, q.Enqueue("d1", "pull_request", []byte(`{}`)))
+	now := time.Now()
+	_, err := q.Claim(now)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Retry("d1", now.Add(time.Minute), "mongo is down"))
+	delivery, err := q.Claim(now)
+	assert.NoError(t, err)
+	assert.Nil(t, delivery)
+
+	delivery, err = q.Claim(now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "mongo is down", *delivery.LastError)
+	assert.Equal(t, 2, delivery.Attempts)
+}
+
+func TestQueue_DeadLetterAndReplay(t *testing.T) {
+	setUp()
+	defer tearDown()
+
+	q := Init(dbTest)
+	assert.NoError(t, q.Enqueue("d1", "pull_request", []byte(`{}`)))
+	now := time.Now()
+	delivery, err := q.Claim(now)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.DeadLetter(*delivery, "invalid payload"))
+	deadLetters, err := q.FindDeadLetters()
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "invalid payload", *deadLetters[0].LastError)
+	delivery, err = q.Claim(now.Add(2 * LeaseDuration))
+	assert.NoError(t, err)
+	assert.Nil(t, delivery)
+
+	assert.NoError(t, q.Replay("d1"))
+	deadLetters, err = q.FindDeadLetters()
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 0)
+	delivery, err = q.Claim(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivery.Attempts)
+
+	assert.ErrorIs(t, q.Replay("unknown"), mongo.ErrNoDocuments)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1, 30*time.Second, time.Hour))
+	assert.Equal(t, 60*time.Second, Backoff(2, 30*time.Second, time.Hour))
+	assert.Equal(t, 8*time.Minute, Backoff(5, 30*time.Second, time.Hour))
+	assert.Equal(t, time.Hour, Backoff(20, 30*time.Second, time.Hour))
+}
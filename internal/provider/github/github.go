@@ -10,6 +10,7 @@ import (
 	"golang.org/x/oauth2"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -26,6 +27,43 @@ type OAuthAppTokenDetails struct {
 	TokenType   string `json:"token_type"`
 }
 
+// ErrCodeOwnersNotFound is returned when the repository has no CODEOWNERS file
+var ErrCodeOwnersNotFound = errors.New("CODEOWNERS file not found")
+
+// codeOwnersPaths are the locations searched for the CODEOWNERS file, in the order used by GitHub
+// https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners#codeowners-file-location
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Types of the rules of the repository rulesets
+// https://docs.github.com/en/rest/repos/rules?apiVersion=2022-11-28
+const (
+	RuleTypePullRequest          = "pull_request"
+	RuleTypeRequiredStatusChecks = "required_status_checks"
+)
+
+// BranchRule is a rule of the repository rulesets which applies to a branch
+type BranchRule struct {
+	Type              string          `json:"type"`
+	Parameters        json.RawMessage `json:"parameters,omitempty"`
+	RulesetSourceType string          `json:"ruleset_source_type"`
+	RulesetSource     string          `json:"ruleset_source"`
+	RulesetId         int64           `json:"ruleset_id"`
+}
+
+// PullRequestRuleParameters are the parameters of the pull_request rule
+type PullRequestRuleParameters struct {
+	RequiredApprovingReviewCount   int  `json:"required_approving_review_count"`
+	RequireCodeOwnerReview         bool `json:"require_code_owner_review"`
+	DismissStaleReviewsOnPush      bool `json:"dismiss_stale_reviews_on_push"`
+	RequireLastPushApproval        bool `json:"require_last_push_approval"`
+	RequiredReviewThreadResolution bool `json:"required_review_thread_resolution"`
+}
+
+// RequiredStatusChecksRuleParameters are the parameters of the required_status_checks rule
+type RequiredStatusChecksRuleParameters struct {
+	StrictRequiredStatusChecksPolicy bool `json:"strict_required_status_checks_policy"`
+}
+
 type GitHub struct {
 	ctx    context.Context
 	client *github.Client
@@ -70,6 +108,12 @@ func (g *GitHub) Me() (*github.User, error) {
 	return me, err
 }
 
+// GetApp https://docs.github.com/en/rest/apps/apps?apiVersion=2022-11-28#get-the-authenticated-app
+func (g *GitHub) GetApp() (*github.App, error) {
+	app, _, err := g.client.Apps.Get(g.ctx, "")
+	return app, err
+}
+
 func (g *GitHub) GetAppInstallationAccessToken(installationId int64) (*github.InstallationToken, error) {
 	token, _, err := g.client.Apps.CreateInstallationToken(g.ctx, installationId, nil)
 	return token, err
@@ -120,43 +164,127 @@ func (g *GitHub) GetPrById(prNumber int, owner, repo string) (*github.PullReques
 	return pr, nil
 }
 
-func (g *GitHub) GetPRs(owner, repoName string, state *string) ([]*github.PullRequest, error) {
-	prList, prr, err := g.client.PullRequests.List(g.ctx, owner, repoName, nil)
-	if err != nil {
-		return nil, err
+// GetPRs lists the pull requests of the repository, most recently created first. If the state (open, closed or all)
+// is nil, the open pull requests are listed. The pages are listed until limit (0 for all) pull requests accepted by
+// keep (every pull request if nil) are found.
+func (g *GitHub) GetPRs(owner, repoName string, state *string, limit int, keep func(pr *github.PullRequest) bool) ([]*github.PullRequest, error) {
+	opts := &github.PullRequestListOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	if state != nil {
+		opts.State = *state
 	}
 
-	for i := prr.NextPage; i > 0; {
-		prl, r, perr := g.client.PullRequests.List(g.ctx, owner, repoName, &github.PullRequestListOptions{
-			ListOptions: github.ListOptions{
-				Page: i,
-			},
-		})
-		if perr != nil || len(prl) == 0 {
-			if perr != nil {
-				return nil, perr
+	prs := make([]*github.PullRequest, 0)
+	for {
+		prList, r, err := g.client.PullRequests.List(g.ctx, owner, repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prList {
+			if state != nil && *state != "all" && pr.GetState() != *state {
+				continue
+			}
+			if keep != nil && !keep(pr) {
+				continue
 			}
+			prs = append(prs, pr)
+			if limit > 0 && len(prs) >= limit {
+				return prs, nil
+			}
+		}
+		if r.NextPage == 0 || len(prList) == 0 {
+			return prs, nil
+		}
+		opts.Page = r.NextPage
+	}
+}
+
+// GetPRReviews https://docs.github.com/en/rest/pulls/reviews?apiVersion=2022-11-28#list-reviews-for-a-pull-request
+func (g *GitHub) GetPRReviews(owner, repoName string, prNumber int) ([]*github.PullRequestReview, error) {
+	reviews := make([]*github.PullRequestReview, 0)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		r, resp, err := g.client.PullRequests.ListReviews(g.ctx, owner, repoName, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r...)
+		if resp.NextPage == 0 {
 			break
 		}
-		for _, _r := range prl {
-			prList = append(prList, _r)
+		opts.Page = resp.NextPage
+	}
+
+	return reviews, nil
+}
+
+// GetTeamMembers https://docs.github.com/en/rest/teams/members?apiVersion=2022-11-28#list-team-members
+func (g *GitHub) GetTeamMembers(org, teamSlug string) ([]*github.User, error) {
+	members := make([]*github.User, 0)
+	opts := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		m, resp, err := g.client.Teams.ListTeamMembersBySlug(g.ctx, org, teamSlug, opts)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m...)
+		if resp.NextPage == 0 {
+			break
 		}
-		i = r.NextPage
+		opts.Page = resp.NextPage
 	}
 
-	if state == nil {
-		return prList, nil
+	return members, nil
+}
+
+// GetCodeOwners returns the content of the CODEOWNERS file of the repository at the ref (branch)
+func (g *GitHub) GetCodeOwners(owner, repoName, ref string) (string, error) {
+	for _, path := range codeOwnersPaths {
+		content, err := g.GetFileContent(owner, repoName, path, ref)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		return content, nil
 	}
+	return "", ErrCodeOwnersNotFound
+}
 
-	prs := make([]*github.PullRequest, 0)
+// GetFileContent returns the content of the file of the repository at the ref (branch, tag or commit)
+func (g *GitHub) GetFileContent(owner, repoName, path, ref string) (string, error) {
+	file, _, _, err := g.client.Repositories.GetContents(g.ctx, owner, repoName, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", errors.New(path + " is not a file")
+	}
+	return file.GetContent()
+}
 
-	for _, pr := range prList {
-		if *pr.State == *state {
-			prs = append(prs, pr)
+// GetPRFiles returns the names of the files changed by the pull request
+// https://docs.github.com/en/rest/pulls/pulls?apiVersion=2022-11-28#list-pull-requests-files
+func (g *GitHub) GetPRFiles(owner, repoName string, prNumber int) ([]string, error) {
+	files := make([]string, 0)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		f, resp, err := g.client.PullRequests.ListFiles(g.ctx, owner, repoName, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range f {
+			files = append(files, file.GetFilename())
 		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
 	}
 
-	return prs, err
+	return files, nil
 }
 
 func (g *GitHub) GetBranchProtection(repo, branch, owner string) (*github.Protection, error) {
@@ -164,6 +292,83 @@ func (g *GitHub) GetBranchProtection(repo, branch, owner string) (*github.Protec
 	return protection, err
 }
 
+// GetRulesForBranch returns the rules of the active rulesets (of the repository and its organization)
+// which apply to the branch. A repository without any ruleset has no rules.
+// https://docs.github.com/en/rest/repos/rules?apiVersion=2022-11-28#get-rules-for-a-branch
+func (g *GitHub) GetRulesForBranch(owner, repoName, branch string) ([]*BranchRule, error) {
+	rules := make([]*BranchRule, 0)
+	page := 1
+	for page > 0 {
+		u := "repos/" + owner + "/" + repoName + "/rules/branches/" + url.PathEscape(branch) + "?per_page=100&page=" + strconv.Itoa(page)
+		req, err := g.client.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var r []*BranchRule
+		resp, err := g.client.Do(g.ctx, req, &r)
+		if err != nil {
+			if IsNotFound(err) {
+				return rules, nil
+			}
+			return nil, err
+		}
+		rules = append(rules, r...)
+		page = resp.NextPage
+	}
+	return rules, nil
+}
+
+// RequestReviewers requests the review of the PR from the users
+// https://docs.github.com/en/rest/pulls/review-requests?apiVersion=2022-11-28#request-reviewers-for-a-pull-request
+func (g *GitHub) RequestReviewers(owner, repoName string, prNumber int, reviewers []string) error {
+	_, _, err := g.client.PullRequests.RequestReviewers(g.ctx, owner, repoName, prNumber, github.ReviewersRequest{
+		Reviewers: reviewers,
+	})
+	return err
+}
+
+// RemoveReviewers removes the review requests of the PR from the users
+// https://docs.github.com/en/rest/pulls/review-requests?apiVersion=2022-11-28#remove-requested-reviewers-from-a-pull-request
+func (g *GitHub) RemoveReviewers(owner, repoName string, prNumber int, reviewers []string) error {
+	_, err := g.client.PullRequests.RemoveReviewers(g.ctx, owner, repoName, prNumber, github.ReviewersRequest{
+		Reviewers: reviewers,
+	})
+	return err
+}
+
+// GetPermissionLevel returns the permission (admin, write, read or none) of the user on the repository
+// https://docs.github.com/en/rest/collaborators/collaborators?apiVersion=2022-11-28#get-repository-permissions-for-a-user
+func (g *GitHub) GetPermissionLevel(owner, repoName, user string) (string, error) {
+	level, _, err := g.client.Repositories.GetPermissionLevel(g.ctx, owner, repoName, user)
+	if err != nil {
+		return "", err
+	}
+	return level.GetPermission(), nil
+}
+
+// CreateCheckRun creates a completed check run on the commit, with the conclusion (success, failure, ...)
+// and the output shown on the checks of the commit
+// https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
+func (g *GitHub) CreateCheckRun(owner, repoName, headSHA, name, conclusion, title, summary string) error {
+	_, _, err := g.client.Checks.CreateCheckRun(g.ctx, owner, repoName, github.CreateCheckRunOptions{
+		Name:       name,
+		HeadSHA:    headSHA,
+		Status:     github.String("completed"),
+		Conclusion: github.String(conclusion),
+		Output: &github.CheckRunOutput{
+			Title:   github.String(title),
+			Summary: github.String(summary),
+		},
+	})
+	return err
+}
+
+// IsNotFound returns true if the GitHub API responded with 404 Not Found
+func IsNotFound(err error) bool {
+	var ghErr *github.ErrorResponse
+	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
+}
+
 func (g *GitHub) PostComment(repo, owner string, prNumber int, body string) error {
 	_, _, err := g.client.Issues.CreateComment(g.ctx, owner, repo, prNumber, &github.IssueComment{
 		Body: &body,
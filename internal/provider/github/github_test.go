@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestGitHub_GetPRs(t *testing.T) {
+	// 3 pages of 2 PRs, every other PR is merged and the last one is still open
+	requested := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, "http://"+r.Host, r.URL.Path, page+1))
+		}
+		n := (page - 1) * 2
+		fmt.Fprintf(w, `[{"number":%d,"state":"closed","merged_at":"2023-01-01T00:00:00Z"},{"number":%d,"state":"%s"}]`,
+			n+1, n+2, map[bool]string{true: "open", false: "closed"}[page == 3])
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	g := &GitHub{ctx: context.Background(), client: client}
+	closed := "closed"
+	merged := func(pr *github.PullRequest) bool {
+		return pr.MergedAt != nil
+	}
+
+	prs, err := g.GetPRs("owner", "repo", &closed, 0, nil)
+	assert.NoError(t, err)
+	assert.Len(t, prs, 5)
+	assert.Equal(t, 3, requested)
+
+	requested = 0
+	prs, err = g.GetPRs("owner", "repo", &closed, 2, merged)
+	assert.NoError(t, err)
+	if assert.Len(t, prs, 2) {
+		assert.Equal(t, 1, prs[0].GetNumber())
+		assert.Equal(t, 3, prs[1].GetNumber())
+	}
+	// The last page is not listed
+	assert.Equal(t, 2, requested)
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"errors"
+	"github.com/google/go-github/v52/github"
+	"sync"
+	"time"
+)
+
+const (
+	// AppJWTReuse is how long a signed app JWT is reused. GenerateAppJWT signs it for 10 minutes.
+	AppJWTReuse = 8 * time.Minute
+	// InstallationTokenRefreshMargin is how long before its expiry an installation token is refreshed, so that
+	// a token handed out stays valid for the requests made with it
+	InstallationTokenRefreshMargin = 5 * time.Minute
+)
+
+var (
+	// ErrInstallationTokenMissing is returned when GitHub returns an installation token without a token
+	ErrInstallationTokenMissing = errors.New("the installation access token is missing")
+	// ErrAppSlugMissing is returned when GitHub returns the app without its slug
+	ErrAppSlugMissing = errors.New("the slug of the app is missing")
+)
+
+// TokenManager hands out the installation access tokens of the GitHub app. The tokens are cached per installation
+// until shortly before they expire, and the app JWT used to mint them is signed once per AppJWTReuse. It is safe
+// for concurrent use.
+type TokenManager struct {
+	key   string
+	appId string
+
+	mu           sync.Mutex
+	jwt          string
+	jwtSignedAt  time.Time
+	installation map[int64]*installationToken
+	botLogin     string
+
+	// now, mint and fetchApp are replaced by the tests
+	now      func() time.Time
+	mint     func(jwt string, installationId int64) (*github.InstallationToken, error)
+	fetchApp func(jwt string) (*github.App, error)
+}
+
+// installationToken is the cached token of an installation. Its lock is held while the token is minted, so that
+// the concurrent callers of the same installation wait for a single token.
+type installationToken struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+var (
+	appTokensMu sync.Mutex
+	appTokens   = make(map[string]*TokenManager)
+)
+
+// AppTokens returns the token manager of the app, shared by every caller of the same app. A new manager replaces
+// the shared one when the private key of the app changes.
+func AppTokens(key string, appId string) *TokenManager {
+	appTokensMu.Lock()
+	defer appTokensMu.Unlock()
+
+	m, found := appTokens[appId]
+	if !found || m.key != key {
+		m = NewTokenManager(key, appId)
+		appTokens[appId] = m
+	}
+	return m
+}
+
+// NewTokenManager returns a token manager of the app, signing its JWT with the private key (PEM)
+func NewTokenManager(key string, appId string) *TokenManager {
+	return &TokenManager{
+		key:          key,
+		appId:        appId,
+		installation: make(map[int64]*installationToken),
+		now:          time.Now,
+		mint: func(jwt string, installationId int64) (*github.InstallationToken, error) {
+			return Init(jwt).GetAppInstallationAccessToken(installationId)
+		},
+		fetchApp: func(jwt string) (*github.App, error) {
+			return Init(jwt).GetApp()
+		},
+	}
+}
+
+// AppJWT returns the JWT authenticating as the app, signing a new one once the current one is AppJWTReuse old
+func (m *TokenManager) AppJWT() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.jwt) > 0 && m.now().Sub(m.jwtSignedAt) < AppJWTReuse {
+		return m.jwt, nil
+	}
+	signedAt := m.now()
+	jwt, err := GenerateAppJWT(m.key, m.appId)
+	if err != nil {
+		return "", err
+	}
+	m.jwt, m.jwtSignedAt = *jwt, signedAt
+	return m.jwt, nil
+}
+
+// BotLogin returns the login of the bot user of the app, <slug>[bot], acting on behalf of the app on GitHub.
+// It is fetched once and cached.
+func (m *TokenManager) BotLogin() (string, error) {
+	m.mu.Lock()
+	botLogin := m.botLogin
+	m.mu.Unlock()
+	if len(botLogin) > 0 {
+		return botLogin, nil
+	}
+
+	jwt, err := m.AppJWT()
+	if err != nil {
+		return "", err
+	}
+	app, err := m.fetchApp(jwt)
+	if err != nil {
+		return "", err
+	}
+	if len(app.GetSlug()) == 0 {
+		return "", ErrAppSlugMissing
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.botLogin = app.GetSlug() + "[bot]"
+	return m.botLogin, nil
+}
+
+// InstallationToken returns the access token of the installation, minting a new one if the cached one expires
+// within InstallationTokenRefreshMargin
+func (m *TokenManager) InstallationToken(installationId int64) (string, error) {
+	m.mu.Lock()
+	cached, found := m.installation[installationId]
+	if !found {
+		cached = new(installationToken)
+		m.installation[installationId] = cached
+	}
+	m.mu.Unlock()
+
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+	if len(cached.token) > 0 && m.now().Add(InstallationTokenRefreshMargin).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	jwt, err := m.AppJWT()
+	if err != nil {
+		return "", err
+	}
+	token, err := m.mint(jwt, installationId)
+	if err != nil {
+		return "", err
+	}
+	if len(token.GetToken()) == 0 {
+		return "", ErrInstallationTokenMissing
+	}
+	cached.token = token.GetToken()
+	// The tokens expire after an hour, a token without its expiry is used only once
+	cached.expiresAt = token.GetExpiresAt().Time
+	return cached.token, nil
+}
+
+// Client returns the GitHub client authenticated as the installation
+func (m *TokenManager) Client(installationId int64) (*GitHub, error) {
+	token, err := m.InstallationToken(installationId)
+	if err != nil {
+		return nil, err
+	}
+	return Init(token), nil
+}
+
+// Invalidate forgets the cached token of the installation, e.g. once its repositories or permissions change
+func (m *TokenManager) Invalidate(installationId int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.installation, installationId)
+}
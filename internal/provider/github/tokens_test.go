@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testTokenManager(t *testing.T) (*TokenManager, *time.Time, *int32) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	now := time.Unix(1700000000, 0)
+	minted := new(int32)
+	m := NewTokenManager(string(key), "1")
+	m.now = func() time.Time { return now }
+	m.mint = func(jwt string, installationId int64) (*github.InstallationToken, error) {
+		n := atomic.AddInt32(minted, 1)
+		return &github.InstallationToken{
+			Token:     github.String(fmt.Sprintf("token-%d-%d", installationId, n)),
+			ExpiresAt: &github.Timestamp{Time: now.Add(time.Hour)},
+		}, nil
+	}
+	m.fetchApp = func(jwt string) (*github.App, error) {
+		atomic.AddInt32(minted, 1)
+		return &github.App{Slug: github.String("nudge")}, nil
+	}
+	return m, &now, minted
+}
+
+func TestTokenManager_InstallationToken(t *testing.T) {
+	m, now, minted := testTokenManager(t)
+
+	token, err := m.InstallationToken(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1-1", token)
+	token, _ = m.InstallationToken(1)
+	assert.Equal(t, "token-1-1", token)
+	token, _ = m.InstallationToken(2)
+	assert.Equal(t, "token-2-2", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(minted))
+
+	// Refreshed shortly before it expires
+	*now = now.Add(time.Hour - InstallationTokenRefreshMargin)
+	token, _ = m.InstallationToken(1)
+	assert.Equal(t, "token-1-3", token)
+
+	m.Invalidate(1)
+	token, _ = m.InstallationToken(1)
+	assert.Equal(t, "token-1-4", token)
+}
+
+func TestTokenManager_AppJWT(t *testing.T) {
+	m, now, _ := testTokenManager(t)
+
+	jwt, err := m.AppJWT()
+	assert.NoError(t, err)
+	*now = now.Add(AppJWTReuse - time.Second)
+	reused, _ := m.AppJWT()
+	assert.Equal(t, jwt, reused)
+
+	*now = now.Add(time.Second)
+	signedAt := m.jwtSignedAt
+	_, err = m.AppJWT()
+	assert.NoError(t, err)
+	assert.True(t, m.jwtSignedAt.After(signedAt))
+
+	_, err = NewTokenManager("not a key", "1").AppJWT()
+	assert.Error(t, err)
+}
+
+func TestTokenManager_BotLogin(t *testing.T) {
+	m, _, fetched := testTokenManager(t)
+
+	login, err := m.BotLogin()
+	assert.NoError(t, err)
+	assert.Equal(t, "nudge[bot]", login)
+	login, _ = m.BotLogin()
+	assert.Equal(t, "nudge[bot]", login)
+	assert.Equal(t, int32(1), atomic.LoadInt32(fetched))
+
+	m, _, _ = testTokenManager(t)
+	m.fetchApp = func(jwt string) (*github.App, error) {
+		return &github.App{}, nil
+	}
+	_, err = m.BotLogin()
+	assert.ErrorIs(t, err, ErrAppSlugMissing)
+}
+
+func TestTokenManager_ConcurrentUse(t *testing.T) {
+	m, _, minted := testTokenManager(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(installationId int64) {
+			defer wg.Done()
+			_, err := m.InstallationToken(installationId)
+			assert.NoError(t, err)
+		}(int64(i % 5))
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), atomic.LoadInt32(minted))
+}
+
+func TestAppTokens(t *testing.T) {
+	m := AppTokens("key", "42")
+	assert.Same(t, m, AppTokens("key", "42"))
+	assert.NotSame(t, m, AppTokens("rotated key", "42"))
+}
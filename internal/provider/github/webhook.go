@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/go-github/v52/github"
+	"io"
+	"mime"
+	"net/http"
+)
+
+var (
+	ErrWebhookSecretMissing = errors.New("the webhook secret is not configured")
+	ErrWebhookUnsigned      = errors.New("the webhook delivery is not signed")
+	ErrWebhookSignature     = errors.New("the webhook delivery is not signed with the webhook secret")
+)
+
+// ValidateWebhook returns the (JSON) payload of the webhook delivery, if it is signed with one of the secrets.
+// More than one secret is active while the webhook secret is being rotated.
+func ValidateWebhook(r *http.Request, secrets [][]byte) ([]byte, error) {
+	active := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			active = append(active, secret)
+		}
+	}
+	if len(active) == 0 {
+		return nil, ErrWebhookSecretMissing
+	}
+
+	signature := r.Header.Get(github.SHA256SignatureHeader)
+	if len(signature) == 0 {
+		signature = r.Header.Get(github.SHA1SignatureHeader)
+	}
+	if len(signature) == 0 {
+		return nil, ErrWebhookUnsigned
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, secret := range active {
+		payload, vErr := github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), signature, secret)
+		if vErr == nil {
+			return payload, nil
+		}
+	}
+	return nil, ErrWebhookSignature
+}
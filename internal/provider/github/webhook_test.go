@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	body := `{"action":"deleted"}`
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	delivery := func(signature string) *http.Request {
+		r, _ := http.NewRequest("POST", "/github/app/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if len(signature) > 0 {
+			r.Header.Set("X-Hub-Signature-256", signature)
+		}
+		return r
+	}
+	secrets := [][]byte{[]byte("current"), []byte("previous")}
+
+	payload, err := ValidateWebhook(delivery(sign("current")), secrets)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(payload))
+
+	// Signed with the secret being rotated out
+	_, err = ValidateWebhook(delivery(sign("previous")), secrets)
+	assert.NoError(t, err)
+
+	_, err = ValidateWebhook(delivery(sign("forged")), secrets)
+	assert.ErrorIs(t, err, ErrWebhookSignature)
+
+	_, err = ValidateWebhook(delivery(""), secrets)
+	assert.ErrorIs(t, err, ErrWebhookUnsigned)
+
+	_, err = ValidateWebhook(delivery(sign("current")), [][]byte{nil, []byte("")})
+	assert.ErrorIs(t, err, ErrWebhookSecretMissing)
+}
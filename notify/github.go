@@ -2,6 +2,7 @@ package notify
 
 import (
 	"log"
+	"nudge/actor"
 	"nudge/internal/database/pr"
 	"nudge/internal/database/repository"
 	provider "nudge/internal/provider/github"
@@ -21,16 +22,13 @@ func GithubNotificationInit(ko *koanf.Koanf, lo *log.Logger) *GitHubNotification
 	}
 }
 
-func (n *GitHubNotification) Post(repo repository.RepoModel, pr pr.PRModel, actorToNotify string, isReviewer bool) error {
-	jwt, _ := provider.GenerateAppJWT(n.ko.String("app.private_key"), n.ko.String("github.app_id"))
-	g := provider.Init(*jwt)
-	iToken, appTokenErr := g.GetAppInstallationAccessToken(repo.InstallationId)
+// Post comments on the PR, mentioning every actor blocking it
+func (n *GitHubNotification) Post(repo repository.RepoModel, pr pr.PRModel, actors []actor.ActorDetails) error {
+	g, appTokenErr := provider.AppTokens(n.ko.String("app.private_key"), n.ko.String("github.app_id")).Client(repo.InstallationId)
 	if appTokenErr != nil {
 		return appTokenErr
 	}
-
-	g = provider.Init(*iToken.Token)
-	message := createNotificationMessage(actorToNotify, isReviewer)
+	message := createMultiActorNotificationMessage(actors, messageTemplatesOf(n.ko))
 	err := g.PostComment(repo.Name, repo.Owner, pr.Number, message)
 	return err
 }
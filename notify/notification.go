@@ -2,16 +2,19 @@ package notify
 
 import (
 	"fmt"
+	"github.com/knadh/koanf/v2"
 	"log"
+	"nudge/actor"
 	"nudge/internal/database/pr"
 	"nudge/internal/database/repository"
 	"nudge/internal/database/user"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Notify interface {
-	Post(repo repository.RepoModel, pr pr.PRModel, actorToNotify string, isReviewer bool) error
+	Post(repo repository.RepoModel, pr pr.PRModel, actors []actor.ActorDetails) error
 }
 
 func createNotificationMessage(actor string, isReviewer bool) string {
@@ -22,6 +25,148 @@ func createNotificationMessage(actor string, isReviewer bool) string {
 	}
 }
 
+// messageTemplates are the descriptions of the blocking reasons configured with bot.messages.<reason code>,
+// replacing the default descriptions. A description can mention {changes_requested_by}, {unresolved_threads}
+// and {missing_approvals}.
+type messageTemplates map[string]string
+
+// messageTemplatesOf returns the descriptions of the blocking reasons configured in ko
+func messageTemplatesOf(ko *koanf.Koanf) messageTemplates {
+	return ko.StringMap("bot.messages")
+}
+
+// createReasonNotificationMessage returns the message for the actor blocking the PR because of the reason
+func createReasonNotificationMessage(actor string, reason actor.BlockingReason, isReviewer bool, templates messageTemplates) string {
+	status := blockingReasonStatus(reason, templates)
+	if len(status) == 0 {
+		return createNotificationMessage(actor, isReviewer)
+	}
+	return fmt.Sprintf("Hello @%s. The PR %s", actor, status)
+}
+
+// createMultiActorNotificationMessage returns the message mentioning every actor blocking the PR. The actors
+// blocking the PR for the same reason are mentioned together, in the order of the actors.
+func createMultiActorNotificationMessage(actors []actor.ActorDetails, templates messageTemplates) string {
+	if len(actors) == 1 {
+		return createReasonNotificationMessage(string(actors[0].GithubUserName), actors[0].Reason, actors[0].IsReviewer, templates)
+	}
+
+	type actorGroup struct {
+		status     string
+		isReviewer bool
+		actors     []string
+	}
+	groups := make([]*actorGroup, 0)
+	for _, a := range actors {
+		status := blockingReasonStatus(a.Reason, templates)
+		var group *actorGroup
+		for _, g := range groups {
+			if g.status == status && g.isReviewer == a.IsReviewer {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &actorGroup{status: status, isReviewer: a.IsReviewer}
+			groups = append(groups, group)
+		}
+		group.actors = append(group.actors, string(a.GithubUserName))
+	}
+
+	messages := make([]string, 0)
+	for _, g := range groups {
+		if len(g.status) == 0 {
+			messages = append(messages, createNotificationMessageWithMultipleActors(g.actors, g.isReviewer))
+			continue
+		}
+		mentions := make([]string, len(g.actors))
+		for i, a := range g.actors {
+			mentions[i] = "@" + a
+		}
+		messages = append(messages, fmt.Sprintf("Hello %s. The PR %s", strings.Join(mentions, " "), g.status))
+	}
+	return strings.Join(messages, "\n\n")
+}
+
+// blockingReasonStatus describes the state of the PR blocked because of the reason, and what the
+// actor needs to do. Returns an empty status for the reasons without a description.
+func blockingReasonStatus(reason actor.BlockingReason, templates messageTemplates) string {
+	reviewers := make([]string, len(reason.ChangesRequestedBy))
+	for i, r := range reason.ChangesRequestedBy {
+		reviewers[i] = string(r)
+	}
+	if template, ok := templates[string(reason.Code)]; ok && len(reason.Code) > 0 {
+		return strings.NewReplacer(
+			"{changes_requested_by}", strings.Join(reviewers, ", "),
+			"{unresolved_threads}", strconv.Itoa(reason.UnresolvedThreads),
+			"{missing_approvals}", strconv.Itoa(reason.MissingApprovals),
+		).Replace(template)
+	}
+
+	switch reason.Code {
+	case actor.ReasonAwaitingFirstReview:
+		return "is awaiting your review. Please review it ASAP."
+	case actor.ReasonChangesRequested:
+		return fmt.Sprintf("is blocked on the changes requested by %s. Please complete them ASAP.", strings.Join(reviewers, ", "))
+	case actor.ReasonUnresolvedThreads:
+		return fmt.Sprintf("has %d unresolved review thread(s). Please address them ASAP.", reason.UnresolvedThreads)
+	case actor.ReasonApprovedNotMerged:
+		return "is approved. Please merge it ASAP."
+	case actor.ReasonCIFailing:
+		return "is blocked on its failing checks. Please fix them ASAP."
+	case actor.ReasonMergeConflict:
+		return "has conflicts with the base branch. Please resolve them ASAP."
+	case actor.ReasonBehindBase:
+		return "is behind the base branch. Please rebase it ASAP."
+	case actor.ReasonNotEnoughApprovals:
+		if reason.MissingApprovals > 0 {
+			return fmt.Sprintf("needs %d more approval(s). Please review it ASAP.", reason.MissingApprovals)
+		}
+		return "is blocked on your approval. Please review it ASAP."
+	default:
+		return ""
+	}
+}
+
+// CreateVerdictMessage returns the reply to /nudge why, explaining whether the nudges of the PR are held
+// back, and which actors are blocking the PR and why. The actors are not mentioned, so that the reply
+// does not notify them.
+func CreateVerdictMessage(ko *koanf.Koanf, prModel pr.PRModel, actors []actor.ActorDetails, now time.Time) string {
+	lines := make([]string, 0)
+	if prModel.NudgeDisabled != nil && *prModel.NudgeDisabled {
+		lines = append(lines, "The nudges of this PR are stopped. Comment `/nudge resume` to resume them.")
+	} else if prModel.SnoozedUntil != nil && *prModel.SnoozedUntil > now.Unix() {
+		until := time.Unix(*prModel.SnoozedUntil, 0).UTC().Format("Mon, 02 Jan 2006 15:04 MST")
+		lines = append(lines, fmt.Sprintf("The nudges of this PR are snoozed until %s.", until))
+	}
+	openHours := int(now.Sub(time.Unix(prModel.PRCreatedAt, 0)).Hours())
+	lines = append(lines, fmt.Sprintf("The PR was predicted to be merged within %d hour(s), and has been open for %d hour(s).", prModel.LifeTime, openHours))
+
+	if len(actors) == 0 {
+		lines = append(lines, "Nobody is blocking the PR.")
+		return strings.Join(lines, "\n\n")
+	}
+	templates := messageTemplatesOf(ko)
+	blockers := []string{"The PR is blocked on:"}
+	for _, a := range actors {
+		status := blockingReasonStatus(a.Reason, templates)
+		if len(status) == 0 {
+			if a.IsReviewer {
+				status = "is blocked on your approval."
+			} else {
+				status = "is blocked on your changes."
+			}
+		}
+		code := a.Reason.Code
+		if len(code) == 0 {
+			code = "blocking"
+		}
+		blockers = append(blockers, fmt.Sprintf("- %s (`%s`): the PR %s", a.GithubUserName, code, status))
+	}
+	lines = append(lines, strings.Join(blockers, "\n"))
+	return strings.Join(lines, "\n\n")
+}
+
 func createNotificationMessageWithMultipleActors(actors []string, isReviewer bool) string {
 	if isReviewer {
 		actorStr := ""
@@ -2,7 +2,10 @@ package notify
 
 import (
 	"errors"
+	"github.com/knadh/koanf/v2"
 	"log"
+	"nudge/actor"
+	"nudge/internal/database/pr"
 	"nudge/internal/database/user"
 	"os"
 	"testing"
@@ -35,6 +38,109 @@ func TestCreateNotificationMessage(t *testing.T) {
 	}
 }
 
+func TestCreateReasonNotificationMessage(t *testing.T) {
+	testCases := []struct {
+		reason     actor.BlockingReason
+		isReviewer bool
+		expected   string
+	}{
+		{
+			reason:     actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview},
+			isReviewer: true,
+			expected:   "Hello @Jane. The PR is awaiting your review. Please review it ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonChangesRequested, ChangesRequestedBy: []actor.GithubUserName{"alice", "bob"}},
+			expected: "Hello @Jane. The PR is blocked on the changes requested by alice, bob. Please complete them ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonUnresolvedThreads, UnresolvedThreads: 2},
+			expected: "Hello @Jane. The PR has 2 unresolved review thread(s). Please address them ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonApprovedNotMerged},
+			expected: "Hello @Jane. The PR is approved. Please merge it ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonCIFailing},
+			expected: "Hello @Jane. The PR is blocked on its failing checks. Please fix them ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonMergeConflict},
+			expected: "Hello @Jane. The PR has conflicts with the base branch. Please resolve them ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{Code: actor.ReasonBehindBase},
+			expected: "Hello @Jane. The PR is behind the base branch. Please rebase it ASAP.",
+		},
+		{
+			reason:     actor.BlockingReason{Code: actor.ReasonNotEnoughApprovals, ApprovalsRequired: 2, MissingApprovals: 1},
+			isReviewer: true,
+			expected:   "Hello @Jane. The PR needs 1 more approval(s). Please review it ASAP.",
+		},
+		{
+			reason:     actor.BlockingReason{Code: actor.ReasonNotEnoughApprovals},
+			isReviewer: true,
+			expected:   "Hello @Jane. The PR is blocked on your approval. Please review it ASAP.",
+		},
+		{
+			reason:   actor.BlockingReason{},
+			expected: "Hello @Jane. The PR is blocked on your changes. Please complete it ASAP.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.reason.Code), func(t *testing.T) {
+			assert.Equal(t, tc.expected, createReasonNotificationMessage("Jane", tc.reason, tc.isReviewer, nil))
+		})
+	}
+}
+
+func TestCreateMultiActorNotificationMessage(t *testing.T) {
+	t.Run("single actor", func(t *testing.T) {
+		actors := []actor.ActorDetails{{IsReviewer: false, GithubUserName: "jane", Reason: actor.BlockingReason{Code: actor.ReasonApprovedNotMerged}}}
+		assert.Equal(t, "Hello @jane. The PR is approved. Please merge it ASAP.", createMultiActorNotificationMessage(actors, nil))
+	})
+
+	t.Run("actors with the same reason", func(t *testing.T) {
+		actors := []actor.ActorDetails{
+			{IsReviewer: true, GithubUserName: "alice", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+			{IsReviewer: true, GithubUserName: "bob", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+		}
+		assert.Equal(t, "Hello @alice @bob. The PR is awaiting your review. Please review it ASAP.", createMultiActorNotificationMessage(actors, nil))
+	})
+
+	t.Run("actors with different reasons", func(t *testing.T) {
+		actors := []actor.ActorDetails{
+			{IsReviewer: true, GithubUserName: "alice", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+			{IsReviewer: true, GithubUserName: "bob", Reason: actor.BlockingReason{Code: actor.ReasonNotEnoughApprovals, MissingApprovals: 1}},
+			{IsReviewer: true, GithubUserName: "carol", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+		}
+		assert.Equal(t, "Hello @alice @carol. The PR is awaiting your review. Please review it ASAP.\n\n"+
+			"Hello @bob. The PR needs 1 more approval(s). Please review it ASAP.", createMultiActorNotificationMessage(actors, nil))
+	})
+
+	t.Run("actors without a reason", func(t *testing.T) {
+		actors := []actor.ActorDetails{
+			{IsReviewer: true, GithubUserName: "alice"},
+			{IsReviewer: true, GithubUserName: "bob"},
+		}
+		assert.Equal(t, "Hello @alice @bob. The PR is blocked on your approval. Please review it ASAP.", createMultiActorNotificationMessage(actors, nil))
+	})
+
+	t.Run("configured messages", func(t *testing.T) {
+		templates := messageTemplates{
+			string(actor.ReasonChangesRequested): "waits on the changes requested by {changes_requested_by}.",
+		}
+		actors := []actor.ActorDetails{
+			{GithubUserName: "jane", Reason: actor.BlockingReason{Code: actor.ReasonChangesRequested, ChangesRequestedBy: []actor.GithubUserName{"alice", "bob"}}},
+			{IsReviewer: true, GithubUserName: "carol", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+		}
+		assert.Equal(t, "Hello @jane. The PR waits on the changes requested by alice, bob.\n\n"+
+			"Hello @carol. The PR is awaiting your review. Please review it ASAP.", createMultiActorNotificationMessage(actors, templates))
+	})
+}
+
 func TestIsWithinBusinessHours(t *testing.T) {
 	testCases := []struct {
 		description    string
@@ -194,3 +300,35 @@ func TestCreateNotificationMessageWithMultipleActors(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateVerdictMessage(t *testing.T) {
+	now := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+	prModel := pr.PRModel{LifeTime: 24, PRCreatedAt: now.Add(-30 * time.Hour).Unix()}
+
+	t.Run("blocked", func(t *testing.T) {
+		actors := []actor.ActorDetails{
+			{IsReviewer: true, GithubUserName: "alice", Reason: actor.BlockingReason{Code: actor.ReasonAwaitingFirstReview}},
+			{GithubUserName: "jane"},
+		}
+		assert.Equal(t, "The PR was predicted to be merged within 24 hour(s), and has been open for 30 hour(s).\n\n"+
+			"The PR is blocked on:\n"+
+			"- alice (`awaiting_first_review`): the PR is awaiting your review. Please review it ASAP.\n"+
+			"- jane (`blocking`): the PR is blocked on your changes.", CreateVerdictMessage(koanf.New("."), prModel, actors, now))
+	})
+
+	t.Run("snoozed", func(t *testing.T) {
+		snoozed := prModel
+		until := now.Add(48 * time.Hour).Unix()
+		snoozed.SnoozedUntil = &until
+		assert.Equal(t, "The nudges of this PR are snoozed until Wed, 07 Jun 2023 12:00 UTC.\n\n"+
+			"The PR was predicted to be merged within 24 hour(s), and has been open for 30 hour(s).\n\n"+
+			"Nobody is blocking the PR.", CreateVerdictMessage(koanf.New("."), snoozed, nil, now))
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stopped := prModel
+		disabled := true
+		stopped.NudgeDisabled = &disabled
+		assert.Contains(t, CreateVerdictMessage(koanf.New("."), stopped, nil, now), "The nudges of this PR are stopped.")
+	})
+}
@@ -1,19 +1,18 @@
 package notify
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/google/go-github/v52/github"
 	"github.com/knadh/koanf/v2"
 	"go.mongodb.org/mongo-driver/mongo"
-	"io"
 	"log"
-	"net/http"
+	"nudge/actor"
 	"nudge/internal/database/pr"
 	"nudge/internal/database/repository"
 	"nudge/internal/database/user"
-	"strconv"
+	provider "nudge/internal/provider/github"
+	"strings"
 )
 
 type SlackNotification struct {
@@ -30,19 +29,126 @@ func SlackNotificationInit(ko *koanf.Koanf, lo *log.Logger, db *mongo.Database)
 	}
 }
 
-// Post https://api.slack.com/methods/chat.postMessage
-func (s *SlackNotification) Post(repo repository.RepoModel, pr pr.PRModel, actorToNotify string, isReviewer bool) error {
+// slackDestination is the Slack channel (or user) to which the nudges are posted
+type slackDestination struct {
+	channel string
+	token   string
+}
+
+// Post sends a message to the Slack user mapped to every actor blocking the PR. The actors without
+// a Slack user of their own are notified on the channel of the installation, in a single message.
+// A team is notified on the Slack channel mapped to the team (org/team), or else every member of
+// the team mapped to a Slack user is notified.
+// https://api.slack.com/methods/chat.postMessage
+func (s *SlackNotification) Post(repo repository.RepoModel, pr pr.PRModel, actors []actor.ActorDetails) error {
 	prLink := fmt.Sprintf("https://github.com/%s/%s/pull/%d", repo.Owner, repo.Name, pr.Number)
-	message := createSlackNotificationMessage(actorToNotify, repo.Name, prLink, pr.Number, isReviewer)
+	templates := messageTemplatesOf(s.ko)
+
+	destinations := make([]slackDestination, 0)
+	messages := make(map[slackDestination][]string)
+	errs := make([]error, 0)
+	for _, actorDetails := range actors {
+		actorToNotify := string(actorDetails.GithubUserName)
+		var (
+			actorDestinations []slackDestination
+			err               error
+		)
+		if actorDetails.IsTeam {
+			actorDestinations, err = s.findTeamDestinations(actorToNotify, repo.InstallationId)
+		} else {
+			var destination *slackDestination
+			destination, err = s.findDestination(actorToNotify, repo.InstallationId, true)
+			if destination != nil {
+				actorDestinations = []slackDestination{*destination}
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// No destinations are found if the Slack app has not been installed
+		message := createSlackReasonNotificationMessage(actorToNotify, repo.Name, prLink, pr.Number, actorDetails.Reason, actorDetails.IsReviewer, templates)
+		for _, destination := range actorDestinations {
+			if _, exists := messages[destination]; !exists {
+				destinations = append(destinations, destination)
+			}
+			messages[destination] = append(messages[destination], message)
+		}
+	}
 
+	for _, destination := range destinations {
+		if err := postSlackMessage(destination, messages[destination], pr.PRID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findTeamDestinations returns the Slack channel mapped to the team, or else the Slack users mapped to
+// the members of the team. If none of them is mapped, the channel of the installation is returned.
+func (s *SlackNotification) findTeamDestinations(team string, installationId int64) ([]slackDestination, error) {
+	destination, err := s.findDestination(team, installationId, false)
+	if err != nil {
+		return nil, err
+	}
+	if destination != nil {
+		return []slackDestination{*destination}, nil
+	}
+
+	members, mErr := s.fetchTeamMembers(team, installationId)
+	if mErr != nil {
+		s.lo.Printf("Failed to fetch the members of team %s - %v", team, mErr)
+	}
+	destinations := make([]slackDestination, 0)
+	for _, member := range members {
+		memberDestination, dErr := s.findDestination(member.GetLogin(), installationId, false)
+		if dErr != nil {
+			return nil, dErr
+		}
+		if memberDestination != nil {
+			destinations = append(destinations, *memberDestination)
+		}
+	}
+	if len(destinations) > 0 {
+		return destinations, nil
+	}
+
+	destination, err = s.findDestination(team, installationId, true)
+	if err != nil || destination == nil {
+		return nil, err
+	}
+	return []slackDestination{*destination}, nil
+}
+
+// fetchTeamMembers returns the members of the team (org/team)
+func (s *SlackNotification) fetchTeamMembers(team string, installationId int64) ([]*github.User, error) {
+	org, slug, found := strings.Cut(team, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid team %s", team)
+	}
+	g, appTokenErr := provider.AppTokens(s.ko.String("app.private_key"), s.ko.String("github.app_id")).Client(installationId)
+	if appTokenErr != nil {
+		return nil, appTokenErr
+	}
+	return g.GetTeamMembers(org, slug)
+}
+
+// findDestination returns the Slack channel to notify the actor on. Returns nil if the Slack app
+// has not been installed (or configured for use). Unless withFallback is true, nil is also returned
+// if the actor is not mapped to a Slack user.
+func (s *SlackNotification) findDestination(actorToNotify string, installationId int64, withFallback bool) (*slackDestination, error) {
 	// Fetch slack user details
-	userDetails, uErr := user.Init(s.db).FindUserByGitHubUsername(actorToNotify, repo.InstallationId)
+	userDetails, uErr := user.Init(s.db).FindUserByGitHubUsername(actorToNotify, installationId)
 	if uErr != nil {
+		if errors.Is(uErr, mongo.ErrNoDocuments) && !withFallback {
+			return nil, nil
+		}
 		if errors.Is(uErr, mongo.ErrNoDocuments) {
 			// Check for slack installation and existence of channel
-			slackUserDetails, suErr := user.Init(s.db).FindSlackUserIdFromInstallationId(repo.InstallationId)
+			slackUserDetails, suErr := user.Init(s.db).FindSlackUserIdFromInstallationId(installationId)
 			if suErr != nil {
-				return suErr
+				return nil, suErr
 			}
 			if slackUserDetails.SlackUserId != nil {
 				// If the slack user id exists, then we'll send the notification to
@@ -52,50 +158,39 @@ func (s *SlackNotification) Post(repo repository.RepoModel, pr pr.PRModel, actor
 		}
 
 		if userDetails == nil {
-			return uErr
+			return nil, uErr
 		}
 	}
 
-	if userDetails.SlackUserId != nil && userDetails.SlackAccessToken != nil { // This means that
-		// the Slack app has been installed (or configured for use)
-		channel := *userDetails.SlackUserId
-		if userDetails.GitHubUsername != actorToNotify && userDetails.GithubSlackMapping != nil {
-			// If the actor to notify is not the root user, extract the slack user id
-			// from the stored mapping
-			for _, m := range *userDetails.GithubSlackMapping {
-				if m.GitHubUsername == actorToNotify {
-					channel = m.SlackUserId
-					break
-				}
-			}
-		}
-		postBody, _ := json.Marshal(map[string]string{
-			"text":    message,
-			"channel": channel,
-		})
-
-		bearer := fmt.Sprintf("Bearer %s", *userDetails.SlackAccessToken)
-		req, _ := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(postBody))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Authorization", bearer)
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		defer resp.Body.Close()
-		if err != nil {
-			return err
-		}
+	if userDetails.SlackUserId == nil || userDetails.SlackAccessToken == nil {
+		return nil, nil
+	}
 
-		if resp.StatusCode != 200 {
-			return errors.New("Failed with status code as " + strconv.Itoa(resp.StatusCode))
+	channel := *userDetails.SlackUserId
+	if userDetails.GitHubUsername != actorToNotify && userDetails.GithubSlackMapping != nil {
+		// If the actor to notify is not the root user, extract the slack user id
+		// from the stored mapping
+		for _, m := range *userDetails.GithubSlackMapping {
+			if m.GitHubUsername == actorToNotify {
+				channel = m.SlackUserId
+				break
+			}
 		}
-
-		_, rErr := io.ReadAll(resp.Body)
-		return rErr
-	} else {
-		return nil
 	}
+	return &slackDestination{
+		channel: channel,
+		token:   *userDetails.SlackAccessToken,
+	}, nil
+}
 
+// postSlackMessage posts the messages of the PR to the destination with the buttons to act on the PR. The
+// text of the messages is the fallback shown in the notifications.
+func postSlackMessage(destination slackDestination, messages []string, prId int64) error {
+	return callSlackAPI(destination.token, "chat.postMessage", map[string]interface{}{
+		"text":    strings.Join(messages, "\n"),
+		"channel": destination.channel,
+		"blocks":  createSlackMessageBlocks(messages, prId),
+	})
 }
 
 func createSlackNotificationMessage(actor, repoName, prLink string, prNumber int, isReviewer bool) string {
@@ -106,3 +201,12 @@ func createSlackNotificationMessage(actor, repoName, prLink string, prNumber int
 
 	return fmt.Sprintf("Hello %s. PR <%s|#%d> in repository *%s* is blocked on your %s. Please review it ASAP.", actor, prLink, prNumber, repoName, actionVerb)
 }
+
+// createSlackReasonNotificationMessage returns the Slack message for the actor blocking the PR because of the reason
+func createSlackReasonNotificationMessage(actor, repoName, prLink string, prNumber int, reason actor.BlockingReason, isReviewer bool, templates messageTemplates) string {
+	status := blockingReasonStatus(reason, templates)
+	if len(status) == 0 {
+		return createSlackNotificationMessage(actor, repoName, prLink, prNumber, isReviewer)
+	}
+	return fmt.Sprintf("Hello %s. PR <%s|#%d> in repository *%s* %s", actor, prLink, prNumber, repoName, status)
+}
@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"nudge/actor"
 	"strconv"
 	"strings"
 	"testing"
@@ -51,3 +52,15 @@ func TestCreateSlackNotificationMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateSlackReasonNotificationMessage(t *testing.T) {
+	message := createSlackReasonNotificationMessage("doe", "example-repo", "https://github.com/owner/example-repo/pull/456", 456, actor.BlockingReason{Code: actor.ReasonCIFailing}, false, nil)
+	if message != "Hello doe. PR <https://github.com/owner/example-repo/pull/456|#456> in repository *example-repo* is blocked on its failing checks. Please fix them ASAP." {
+		t.Errorf("Unexpected message %s", message)
+	}
+
+	message = createSlackReasonNotificationMessage("john", "test-repo", "https://github.com/owner/test-repo/pull/123", 123, actor.BlockingReason{}, true, nil)
+	if message != createSlackNotificationMessage("john", "test-repo", "https://github.com/owner/test-repo/pull/123", 123, true) {
+		t.Errorf("Unexpected message %s", message)
+	}
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ErrSlackTokenMissing = errors.New("missing Slack access token or user")
+	ErrSlackTokenInvalid = errors.New("invalid Slack access token")
+	ErrSlackUserMismatch = errors.New("the Slack access token belongs to another user")
+)
+
+// SlackTokenVerifier verifies that a user access token, returned to the browser by the OAuth flow of the Slack
+// app, belongs to the Slack user it is presented for
+// https://api.slack.com/methods/auth.test
+type SlackTokenVerifier struct {
+	url string
+}
+
+func NewSlackTokenVerifier() *SlackTokenVerifier {
+	return &SlackTokenVerifier{url: "https://slack.com/api/auth.test"}
+}
+
+// VerifyUser returns nil if Slack authenticates the token as the user (slackUserId)
+func (v *SlackTokenVerifier) VerifyUser(token, slackUserId string) error {
+	if len(token) == 0 || len(slackUserId) == 0 {
+		return ErrSlackTokenMissing
+	}
+	req, _ := http.NewRequest("POST", v.url, nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Failed with status code as " + strconv.Itoa(resp.StatusCode))
+	}
+	respBody, rErr := io.ReadAll(resp.Body)
+	if rErr != nil {
+		return rErr
+	}
+	var result struct {
+		Ok     bool   `json:"ok"`
+		UserId string `json:"user_id"`
+	}
+	if err = json.Unmarshal(respBody, &result); err != nil || !result.Ok {
+		return ErrSlackTokenInvalid
+	}
+	if result.UserId != slackUserId {
+		return ErrSlackUserMismatch
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlackTokenVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer xoxp-u1":
+			w.Write([]byte(`{"ok":true,"user_id":"U1","team_id":"T1"}`))
+		case "Bearer xoxp-down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+		}
+	}))
+	defer srv.Close()
+	v := &SlackTokenVerifier{url: srv.URL}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, v.VerifyUser("xoxp-u1", "U1"))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		assert.ErrorIs(t, v.VerifyUser("", "U1"), ErrSlackTokenMissing)
+		assert.ErrorIs(t, v.VerifyUser("xoxp-u1", ""), ErrSlackTokenMissing)
+	})
+
+	t.Run("another_user", func(t *testing.T) {
+		assert.ErrorIs(t, v.VerifyUser("xoxp-u1", "U2"), ErrSlackUserMismatch)
+	})
+
+	t.Run("invalid_token", func(t *testing.T) {
+		assert.ErrorIs(t, v.VerifyUser("xoxp-forged", "U1"), ErrSlackTokenInvalid)
+	})
+
+	t.Run("slack_down", func(t *testing.T) {
+		assert.Error(t, v.VerifyUser("xoxp-down", "U1"))
+	})
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Actions of the buttons of the Slack nudges, handled by the interactivity endpoint (/slack/message_action).
+// The action ids of the snooze buttons are suffixed with the duration of the snooze.
+const (
+	SlackActionSnooze   = "nudge_snooze"
+	SlackActionOnIt     = "nudge_on_it"
+	SlackActionReassign = "nudge_reassign"
+)
+
+// SlackReassignCallbackId identifies the submission of the modal reassigning the review of the PR
+const SlackReassignCallbackId = "nudge_reassign_review"
+
+// Block and action of the input of the modal reassigning the review of the PR
+const (
+	SlackReassignBlockId  = "reviewer"
+	SlackReassignActionId = "github_username"
+)
+
+// SlackActionValue is the value of the buttons of the Slack nudges, identifying the PR acted on
+type SlackActionValue struct {
+	PRID int64 `json:"pr_id"`
+	// Snooze is the duration of the snooze (<n><h|d|w>) of the snooze buttons
+	Snooze string `json:"snooze,omitempty"`
+}
+
+// SlackText is a text object of Block Kit
+// https://api.slack.com/reference/block-kit/composition-objects#text
+type SlackText struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// SlackElement is an interactive element (button, input) of Block Kit
+// https://api.slack.com/reference/block-kit/block-elements
+type SlackElement struct {
+	Type     string     `json:"type"`
+	Text     *SlackText `json:"text,omitempty"`
+	ActionId string     `json:"action_id,omitempty"`
+	Value    string     `json:"value,omitempty"`
+	Style    string     `json:"style,omitempty"`
+}
+
+// SlackBlock is a layout block of Block Kit
+// https://api.slack.com/reference/block-kit/blocks
+type SlackBlock struct {
+	Type     string         `json:"type"`
+	BlockId  string         `json:"block_id,omitempty"`
+	Text     *SlackText     `json:"text,omitempty"`
+	Label    *SlackText     `json:"label,omitempty"`
+	Element  *SlackElement  `json:"element,omitempty"`
+	Elements []SlackElement `json:"elements,omitempty"`
+}
+
+// createSlackMessageBlocks returns the Block Kit blocks of the nudge of the PR: a section per message,
+// followed by the buttons to snooze the nudges, to acknowledge the PR, and to reassign its review
+func createSlackMessageBlocks(messages []string, prId int64) []SlackBlock {
+	blocks := make([]SlackBlock, 0, len(messages)+1)
+	for _, message := range messages {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: message},
+		})
+	}
+
+	button := func(text, actionId string, value SlackActionValue, style string) SlackElement {
+		v, _ := json.Marshal(value)
+		return SlackElement{
+			Type:     "button",
+			Text:     &SlackText{Type: "plain_text", Text: text, Emoji: true},
+			ActionId: actionId,
+			Value:    string(v),
+			Style:    style,
+		}
+	}
+	blocks = append(blocks, SlackBlock{
+		Type:    "actions",
+		BlockId: "nudge_actions_" + strconv.FormatInt(prId, 10),
+		Elements: []SlackElement{
+			button("I'm on it", SlackActionOnIt, SlackActionValue{PRID: prId}, "primary"),
+			// Slack requires a unique action_id per element of the block
+			button("Snooze 4h", SlackActionSnooze+"_4h", SlackActionValue{PRID: prId, Snooze: "4h"}, ""),
+			button("Snooze 1 day", SlackActionSnooze+"_1d", SlackActionValue{PRID: prId, Snooze: "1d"}, ""),
+			button("Reassign review", SlackActionReassign, SlackActionValue{PRID: prId}, ""),
+		},
+	})
+	return blocks
+}
+
+// CreateSlackReassignView returns the modal asking for the GitHub user to reassign the review of the PR to
+// https://api.slack.com/reference/surfaces/views
+func CreateSlackReassignView(prId int64, prNumber int, repoName string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":             "modal",
+		"callback_id":      SlackReassignCallbackId,
+		"private_metadata": strconv.FormatInt(prId, 10),
+		"title":            SlackText{Type: "plain_text", Text: "Reassign review"},
+		"submit":           SlackText{Type: "plain_text", Text: "Reassign"},
+		"close":            SlackText{Type: "plain_text", Text: "Cancel"},
+		"blocks": []SlackBlock{
+			{
+				Type: "section",
+				Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("Reassign your review of PR #%d in repository *%s*.", prNumber, repoName)},
+			},
+			{
+				Type:    "input",
+				BlockId: SlackReassignBlockId,
+				Label:   &SlackText{Type: "plain_text", Text: "GitHub username of the new reviewer"},
+				Element: &SlackElement{Type: "plain_text_input", ActionId: SlackReassignActionId},
+			},
+		},
+	}
+}
+
+// OpenSlackView opens the modal view in response to the interaction (triggerId) of the user
+// https://api.slack.com/methods/views.open
+func OpenSlackView(token, triggerId string, view interface{}) error {
+	return callSlackAPI(token, "views.open", map[string]interface{}{
+		"trigger_id": triggerId,
+		"view":       view,
+	})
+}
+
+// RespondToSlackAction sends an ephemeral message to the user who interacted with the message, using
+// the response URL of the interaction
+// https://api.slack.com/interactivity/handling#message_responses
+func RespondToSlackAction(responseUrl, text string) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+	resp, err := http.Post(responseUrl, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Failed with status code as " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// callSlackAPI calls the method of the Slack Web API. Slack responds with 200 OK to the failed calls
+// as well, with the error in the body.
+func callSlackAPI(token, method string, payload interface{}) error {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "https://slack.com/api/"+method, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Failed with status code as " + strconv.Itoa(resp.StatusCode))
+	}
+	respBody, rErr := io.ReadAll(resp.Body)
+	if rErr != nil {
+		return rErr
+	}
+	var result struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err = json.Unmarshal(respBody, &result); err == nil && !result.Ok {
+		return fmt.Errorf("slack %s failed - %s", method, result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateSlackMessageBlocks(t *testing.T) {
+	blocks := createSlackMessageBlocks([]string{"Hello alice.", "Hello bob."}, 42)
+	assert.Len(t, blocks, 3)
+	assert.Equal(t, "section", blocks[0].Type)
+	assert.Equal(t, "Hello bob.", blocks[1].Text.Text)
+
+	actions := blocks[2]
+	assert.Equal(t, "actions", actions.Type)
+	actionIds := make([]string, len(actions.Elements))
+	for i, element := range actions.Elements {
+		actionIds[i] = element.ActionId
+	}
+	assert.Equal(t, []string{SlackActionOnIt, SlackActionSnooze + "_4h", SlackActionSnooze + "_1d", SlackActionReassign}, actionIds)
+
+	var value SlackActionValue
+	assert.NoError(t, json.Unmarshal([]byte(actions.Elements[2].Value), &value))
+	assert.Equal(t, SlackActionValue{PRID: 42, Snooze: "1d"}, value)
+}
+
+func TestCreateSlackReassignView(t *testing.T) {
+	view := CreateSlackReassignView(42, 7, "nudge")
+	assert.Equal(t, SlackReassignCallbackId, view["callback_id"])
+	assert.Equal(t, "42", view["private_metadata"])
+	blocks := view["blocks"].([]SlackBlock)
+	assert.Equal(t, SlackReassignBlockId, blocks[1].BlockId)
+	assert.Equal(t, SlackReassignActionId, blocks[1].Element.ActionId)
+}
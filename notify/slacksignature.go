@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SlackRequestMaxAge is the maximum age of a request signed by Slack. The older requests are rejected as replays.
+const SlackRequestMaxAge = 5 * time.Minute
+
+var (
+	ErrSlackSigningSecretMissing = errors.New("the Slack signing secret is not configured")
+	ErrSlackSignatureMissing     = errors.New("missing Slack signature or request timestamp")
+	ErrSlackRequestExpired       = errors.New("the Slack request timestamp is too old or in the future")
+	ErrSlackSignatureInvalid     = errors.New("invalid Slack signature")
+	ErrSlackRequestReplayed      = errors.New("the Slack request has already been received")
+)
+
+// SlackVerifier verifies the signature of the requests from Slack with the signing secret of the Slack app
+// https://api.slack.com/authentication/verifying-requests-from-slack
+type SlackVerifier struct {
+	signingSecret string
+	mu            sync.Mutex
+	// seen holds the signatures received within SlackRequestMaxAge, with their timestamp
+	seen map[string]int64
+}
+
+func NewSlackVerifier(signingSecret string) *SlackVerifier {
+	return &SlackVerifier{
+		signingSecret: signingSecret,
+		seen:          make(map[string]int64),
+	}
+}
+
+// Verify checks the signature (X-Slack-Signature) of the body, signed at the timestamp (X-Slack-Request-Timestamp).
+// A request is accepted only once, and only within SlackRequestMaxAge of its timestamp.
+func (v *SlackVerifier) Verify(timestamp, signature string, body []byte, now time.Time) error {
+	if len(v.signingSecret) == 0 {
+		return ErrSlackSigningSecretMissing
+	}
+	if len(timestamp) == 0 || len(signature) == 0 {
+		return ErrSlackSignatureMissing
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSlackSignatureInvalid
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > SlackRequestMaxAge || age < -SlackRequestMaxAge {
+		return ErrSlackRequestExpired
+	}
+
+	if !hmac.Equal([]byte(SignSlackRequest(v.signingSecret, timestamp, body)), []byte(signature)) {
+		return ErrSlackSignatureInvalid
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for s, t := range v.seen {
+		if now.Sub(time.Unix(t, 0)) > SlackRequestMaxAge {
+			delete(v.seen, s)
+		}
+	}
+	if _, found := v.seen[signature]; found {
+		return ErrSlackRequestReplayed
+	}
+	v.seen[signature] = ts
+	return nil
+}
+
+// SignSlackRequest returns the signature (v0=<hex HMAC-SHA256>) of the body of the request sent at the timestamp
+func SignSlackRequest(signingSecret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
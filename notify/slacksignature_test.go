@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlackVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("token=foo&team_id=T1&user_id=U1&command=%2Fmap-github&text=1+alice")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := SignSlackRequest("secret", timestamp, body)
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, NewSlackVerifier("secret").Verify(timestamp, signature, body, now.Add(time.Minute)))
+	})
+
+	t.Run("missing_secret", func(t *testing.T) {
+		assert.ErrorIs(t, NewSlackVerifier("").Verify(timestamp, signature, body, now), ErrSlackSigningSecretMissing)
+	})
+
+	t.Run("missing_headers", func(t *testing.T) {
+		assert.ErrorIs(t, NewSlackVerifier("secret").Verify("", signature, body, now), ErrSlackSignatureMissing)
+		assert.ErrorIs(t, NewSlackVerifier("secret").Verify(timestamp, "", body, now), ErrSlackSignatureMissing)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		v := NewSlackVerifier("secret")
+		assert.ErrorIs(t, v.Verify(timestamp, signature, []byte("user_id=U2"), now), ErrSlackSignatureInvalid)
+		assert.ErrorIs(t, NewSlackVerifier("other").Verify(timestamp, signature, body, now), ErrSlackSignatureInvalid)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		v := NewSlackVerifier("secret")
+		assert.ErrorIs(t, v.Verify(timestamp, signature, body, now.Add(SlackRequestMaxAge+time.Second)), ErrSlackRequestExpired)
+		assert.ErrorIs(t, v.Verify(timestamp, signature, body, now.Add(-SlackRequestMaxAge-time.Second)), ErrSlackRequestExpired)
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		v := NewSlackVerifier("secret")
+		assert.NoError(t, v.Verify(timestamp, signature, body, now))
+		assert.ErrorIs(t, v.Verify(timestamp, signature, body, now.Add(time.Second)), ErrSlackRequestReplayed)
+	})
+}
@@ -1,5 +1,154 @@
 package prediction
 
-func EstimateLifeTime() int {
-	return 2
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/go-github/v52/github"
+	"math"
+	"os"
+	"sort"
+)
+
+// Features are the attributes of a pull request the effort estimation model
+// uses to predict its lifetime
+type Features struct {
+	RepoId        int64
+	Repository    string // full name (owner/name) of the repository
+	LinesAdded    int
+	LinesDeleted  int
+	FilesChanged  int
+	Commits       int
+	Reviewers     int
+	ProtectedBase bool
+	// AuthorMergeHours are the lifetimes (in hours) of the pull requests
+	// previously merged by the author in the same repository
+	AuthorMergeHours []float64
+}
+
+// Coefficients of the log-linear effort estimation model. The predicted
+// lifetime (in hours) is exp(Intercept + Σ coefficient * feature), where
+// the count based features are log transformed (log(1 + x)).
+type Coefficients struct {
+	Intercept     float64 `json:"intercept" bson:"intercept"`
+	LinesAdded    float64 `json:"lines_added" bson:"lines_added"`
+	LinesDeleted  float64 `json:"lines_deleted" bson:"lines_deleted"`
+	FilesChanged  float64 `json:"files_changed" bson:"files_changed"`
+	Commits       float64 `json:"commits" bson:"commits"`
+	AuthorHistory float64 `json:"author_history" bson:"author_history"`
+	Reviewers     float64 `json:"reviewers" bson:"reviewers"`
+	ProtectedBase float64 `json:"protected_base" bson:"protected_base"`
+	MinHours      int     `json:"min_hours" bson:"min_hours"`
+	MaxHours      int     `json:"max_hours" bson:"max_hours"`
+}
+
+// MergeHistory provides the lifetimes of the pull requests merged in the past
+type MergeHistory interface {
+	AuthorMergeHours(repoId int64, author string) ([]float64, error)
+	RepositoryMergeHours(repoId int64) ([]float64, error)
+}
+
+type EffortModel struct {
+	Coefficients Coefficients
+}
+
+// DefaultCoefficients are used when no coefficients file has been configured
+var DefaultCoefficients = Coefficients{
+	Intercept:     0.7,
+	LinesAdded:    0.25,
+	LinesDeleted:  0.1,
+	FilesChanged:  0.2,
+	Commits:       0.15,
+	AuthorHistory: 0.3,
+	Reviewers:     0.1,
+	ProtectedBase: 0.2,
+	MinHours:      1,
+	MaxHours:      24 * 14,
+}
+
+func Init(coefficients Coefficients) *EffortModel {
+	return &EffortModel{
+		Coefficients: coefficients,
+	}
+}
+
+// LoadModel reads the model coefficients from the JSON file at path. If the path
+// is empty, the model is initialized with the DefaultCoefficients
+func LoadModel(path string) (*EffortModel, error) {
+	if len(path) == 0 {
+		return Init(DefaultCoefficients), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var coefficients Coefficients
+	if err = json.Unmarshal(data, &coefficients); err != nil {
+		return nil, err
+	}
+	if coefficients.MinHours <= 0 || coefficients.MaxHours < coefficients.MinHours {
+		return nil, errors.New("invalid bounds for the predicted lifetime in the coefficients file")
+	}
+
+	return Init(coefficients), nil
+}
+
+// ExtractFeatures reads the size related features from the pull request. The author's
+// history and the protection of the base branch are not a part of the pull request and
+// must be filled in by the caller.
+// Note: The additions, deletions, changed files and commits are only present when the pull
+// request is fetched individually (or received via the webhook). These are zero for the
+// pull requests fetched using the list API.
+func ExtractFeatures(pr github.PullRequest) Features {
+	return Features{
+		LinesAdded:   pr.GetAdditions(),
+		LinesDeleted: pr.GetDeletions(),
+		FilesChanged: pr.GetChangedFiles(),
+		Commits:      pr.GetCommits(),
+		Reviewers:    len(pr.RequestedReviewers),
+	}
+}
+
+// EstimateLifeTime returns the predicted lifetime of the pull request in hours
+func (m *EffortModel) EstimateLifeTime(f Features) int {
+	c := m.Coefficients
+	score := c.Intercept +
+		c.LinesAdded*math.Log1p(float64(f.LinesAdded)) +
+		c.LinesDeleted*math.Log1p(float64(f.LinesDeleted)) +
+		c.FilesChanged*math.Log1p(float64(f.FilesChanged)) +
+		c.Commits*math.Log1p(float64(f.Commits)) +
+		c.Reviewers*float64(f.Reviewers)
+
+	if len(f.AuthorMergeHours) > 0 {
+		// Authors whose changes have historically taken longer to be
+		// merged are likely to take longer this time as well
+		score += c.AuthorHistory * math.Log1p(median(f.AuthorMergeHours))
+	}
+
+	if f.ProtectedBase {
+		score += c.ProtectedBase
+	}
+
+	hours := int(math.Ceil(math.Exp(score)))
+	if hours < c.MinHours {
+		hours = c.MinHours
+	}
+	if c.MaxHours > 0 && hours > c.MaxHours {
+		hours = c.MaxHours
+	}
+
+	return hours
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
 }
@@ -0,0 +1,117 @@
+package prediction
+
+import (
+	"encoding/json"
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadFixturePR(t *testing.T, name string) github.PullRequest {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read the fixture %s: %v", name, err)
+	}
+	var pr github.PullRequest
+	if err = json.Unmarshal(data, &pr); err != nil {
+		t.Fatalf("Failed to parse the fixture %s: %v", name, err)
+	}
+	return pr
+}
+
+func TestLoadModel(t *testing.T) {
+	t.Run("empty_path_uses_defaults", func(t *testing.T) {
+		model, err := LoadModel("")
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultCoefficients, model.Coefficients)
+	})
+
+	t.Run("coefficients_file", func(t *testing.T) {
+		model, err := LoadModel(filepath.Join("testdata", "coefficients.json"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0.5, model.Coefficients.Intercept)
+		assert.Equal(t, 2, model.Coefficients.MinHours)
+		assert.Equal(t, 240, model.Coefficients.MaxHours)
+	})
+
+	t.Run("invalid_bounds", func(t *testing.T) {
+		_, err := LoadModel(filepath.Join("testdata", "coefficients_invalid.json"))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing_file", func(t *testing.T) {
+		_, err := LoadModel(filepath.Join("testdata", "does_not_exist.json"))
+		assert.Error(t, err)
+	})
+}
+
+func TestExtractFeatures(t *testing.T) {
+	pr := loadFixturePR(t, "pr_large_refactor.json")
+	features := ExtractFeatures(pr)
+	assert.Equal(t, Features{
+		LinesAdded:   2400,
+		LinesDeleted: 650,
+		FilesChanged: 58,
+		Commits:      27,
+		Reviewers:    2,
+	}, features)
+}
+
+func TestEstimateLifeTime(t *testing.T) {
+	model, err := LoadModel(filepath.Join("testdata", "coefficients.json"))
+	if err != nil {
+		t.Fatalf("Failed to load the model: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		fixture       string
+		protectedBase bool
+		authorHistory []float64
+		expected      int
+	}{
+		{
+			name:     "typo_fix",
+			fixture:  "pr_typo_fix.json",
+			expected: 3,
+		},
+		{
+			name:          "typo_fix_protected_base",
+			fixture:       "pr_typo_fix.json",
+			protectedBase: true,
+			expected:      4,
+		},
+		{
+			name:     "large_refactor",
+			fixture:  "pr_large_refactor.json",
+			expected: 126,
+		},
+		{
+			name:          "large_refactor_slow_author",
+			fixture:       "pr_large_refactor.json",
+			authorHistory: []float64{10, 100, 40},
+			expected:      240, // capped by the max hours
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			features := ExtractFeatures(loadFixturePR(t, tc.fixture))
+			features.ProtectedBase = tc.protectedBase
+			features.AuthorMergeHours = tc.authorHistory
+			assert.Equal(t, tc.expected, model.EstimateLifeTime(features))
+		})
+	}
+
+	t.Run("min_hours", func(t *testing.T) {
+		m := Init(Coefficients{Intercept: -5, MinHours: 2, MaxHours: 10})
+		assert.Equal(t, 2, m.EstimateLifeTime(Features{}))
+	})
+}
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 2.0, median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 2, 3}))
+}
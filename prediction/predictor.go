@@ -0,0 +1,183 @@
+package prediction
+
+import (
+	"fmt"
+	"github.com/knadh/koanf/v2"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	StrategyModel      = "model"
+	StrategyConstant   = "constant"
+	StrategyPercentile = "percentile"
+	StrategySize       = "size"
+	StrategyTrained    = "trained"
+)
+
+// LifetimePredictor predicts the lifetime (in hours) of a pull request
+type LifetimePredictor interface {
+	EstimateLifeTime(f Features) int
+}
+
+// ConstantPredictor predicts the same lifetime for every pull request
+type ConstantPredictor struct {
+	Hours int
+}
+
+func (c *ConstantPredictor) EstimateLifeTime(f Features) int {
+	return c.Hours
+}
+
+// PercentilePredictor predicts the lifetime as a percentile of the lifetimes of the pull
+// requests merged in the repository. Until the repository has MinSamples merged pull requests,
+// the prediction is delegated to the Fallback predictor.
+type PercentilePredictor struct {
+	Percentile float64
+	MinSamples int
+	History    MergeHistory
+	Fallback   LifetimePredictor
+}
+
+func (p *PercentilePredictor) EstimateLifeTime(f Features) int {
+	hours, err := p.History.RepositoryMergeHours(f.RepoId)
+	if err != nil || len(hours) == 0 || len(hours) < p.MinSamples {
+		return p.Fallback.EstimateLifeTime(f)
+	}
+
+	predicted := int(math.Ceil(percentile(hours, p.Percentile)))
+	if predicted < 1 {
+		predicted = 1
+	}
+	return predicted
+}
+
+// SizePredictor is a heuristic which grows the lifetime linearly with the size of the change
+type SizePredictor struct {
+	BaseHours        float64
+	HoursPer100Lines float64
+	HoursPerFile     float64
+	MaxHours         int
+}
+
+func (s *SizePredictor) EstimateLifeTime(f Features) int {
+	lines := float64(f.LinesAdded + f.LinesDeleted)
+	hours := int(math.Ceil(s.BaseHours + s.HoursPer100Lines*lines/100 + s.HoursPerFile*float64(f.FilesChanged)))
+	if hours < 1 {
+		hours = 1
+	}
+	if s.MaxHours > 0 && hours > s.MaxHours {
+		hours = s.MaxHours
+	}
+	return hours
+}
+
+// RepositoryPredictor dispatches the prediction to the predictor chosen for the repository
+// of the pull request. Repositories without a predictor of their own use the Default.
+type RepositoryPredictor struct {
+	Default      LifetimePredictor
+	Repositories map[string]LifetimePredictor
+}
+
+func (r *RepositoryPredictor) EstimateLifeTime(f Features) int {
+	if p, exists := r.Repositories[strings.ToLower(f.Repository)]; exists {
+		return p.EstimateLifeTime(f)
+	}
+	return r.Default.EstimateLifeTime(f)
+}
+
+// NewPredictor creates the predictor configured under prediction.* in ko. Each entry of
+// prediction.repositories selects the strategy and parameters for the repository
+// named (owner/name) in the entry. Parameters missing from an entry are taken from
+// the global prediction.* configuration.
+func NewPredictor(ko *koanf.Koanf, history MergeHistory, models TrainedModels) (LifetimePredictor, error) {
+	global := ko.Cut("prediction")
+	global.Delete("repositories")
+
+	defaultPredictor, err := predictorFromConfig(global, history, models)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := make(map[string]LifetimePredictor)
+	for _, repoConfig := range ko.Slices("prediction.repositories") {
+		name := strings.ToLower(repoConfig.String("name"))
+		if len(name) == 0 {
+			return nil, fmt.Errorf("missing name for the repository in prediction.repositories")
+		}
+
+		conf := global.Copy()
+		if err = conf.Merge(repoConfig); err != nil {
+			return nil, err
+		}
+		p, pErr := predictorFromConfig(conf, history, models)
+		if pErr != nil {
+			return nil, fmt.Errorf("%s: %v", name, pErr)
+		}
+		repositories[name] = p
+	}
+
+	return &RepositoryPredictor{
+		Default:      defaultPredictor,
+		Repositories: repositories,
+	}, nil
+}
+
+func predictorFromConfig(conf *koanf.Koanf, history MergeHistory, models TrainedModels) (LifetimePredictor, error) {
+	switch conf.String("strategy") {
+	case "", StrategyModel:
+		return LoadModel(conf.String("coefficients_file"))
+	case StrategyConstant:
+		hours := conf.Int("hours")
+		if hours <= 0 {
+			return nil, fmt.Errorf("hours must be positive for the %s strategy", StrategyConstant)
+		}
+		return &ConstantPredictor{Hours: hours}, nil
+	case StrategyPercentile:
+		p := conf.Float64("percentile")
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile must be in (0, 100] for the %s strategy", StrategyPercentile)
+		}
+		fallback, err := LoadModel(conf.String("coefficients_file"))
+		if err != nil {
+			return nil, err
+		}
+		return &PercentilePredictor{
+			Percentile: p,
+			MinSamples: conf.Int("min_samples"),
+			History:    history,
+			Fallback:   fallback,
+		}, nil
+	case StrategyTrained:
+		fallback, err := LoadModel(conf.String("coefficients_file"))
+		if err != nil {
+			return nil, err
+		}
+		return &TrainedPredictor{
+			Models:   models,
+			Fallback: fallback,
+		}, nil
+	case StrategySize:
+		return &SizePredictor{
+			BaseHours:        conf.Float64("base_hours"),
+			HoursPer100Lines: conf.Float64("hours_per_100_lines"),
+			HoursPerFile:     conf.Float64("hours_per_file"),
+			MaxHours:         conf.Int("max_hours"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown lifetime prediction strategy %s", conf.String("strategy"))
+	}
+}
+
+// percentile returns the p-th percentile of values using linear interpolation between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
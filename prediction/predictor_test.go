@@ -0,0 +1,115 @@
+package prediction
+
+import (
+	"errors"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+type MergeHistoryMock struct {
+	mock.Mock
+}
+
+func (m *MergeHistoryMock) AuthorMergeHours(repoId int64, author string) ([]float64, error) {
+	args := m.Called(repoId, author)
+	return args.Get(0).([]float64), args.Error(1)
+}
+
+func (m *MergeHistoryMock) RepositoryMergeHours(repoId int64) ([]float64, error) {
+	args := m.Called(repoId)
+	return args.Get(0).([]float64), args.Error(1)
+}
+
+func TestConstantPredictor(t *testing.T) {
+	p := &ConstantPredictor{Hours: 2}
+	assert.Equal(t, 2, p.EstimateLifeTime(Features{LinesAdded: 3000}))
+}
+
+func TestPercentilePredictor(t *testing.T) {
+	history := &MergeHistoryMock{}
+	history.On("RepositoryMergeHours", int64(1)).Return([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, nil)
+	history.On("RepositoryMergeHours", int64(2)).Return([]float64{5, 6}, nil)
+	history.On("RepositoryMergeHours", int64(3)).Return([]float64{}, errors.New("db down"))
+
+	p := &PercentilePredictor{
+		Percentile: 75,
+		MinSamples: 5,
+		History:    history,
+		Fallback:   &ConstantPredictor{Hours: 42},
+	}
+
+	t.Run("enough_history", func(t *testing.T) {
+		assert.Equal(t, 8, p.EstimateLifeTime(Features{RepoId: 1}))
+	})
+
+	t.Run("not_enough_history", func(t *testing.T) {
+		assert.Equal(t, 42, p.EstimateLifeTime(Features{RepoId: 2}))
+	})
+
+	t.Run("history_error", func(t *testing.T) {
+		assert.Equal(t, 42, p.EstimateLifeTime(Features{RepoId: 3}))
+	})
+}
+
+func TestSizePredictor(t *testing.T) {
+	p := &SizePredictor{BaseHours: 2, HoursPer100Lines: 1, HoursPerFile: 0.5, MaxHours: 48}
+
+	assert.Equal(t, 3, p.EstimateLifeTime(Features{LinesAdded: 1, LinesDeleted: 1, FilesChanged: 1}))
+	assert.Equal(t, 17, p.EstimateLifeTime(Features{LinesAdded: 900, LinesDeleted: 100, FilesChanged: 10}))
+	assert.Equal(t, 48, p.EstimateLifeTime(Features{LinesAdded: 3000, FilesChanged: 60}))
+}
+
+func TestNewPredictor(t *testing.T) {
+	history := &MergeHistoryMock{}
+	history.On("RepositoryMergeHours", int64(1)).Return([]float64{10, 20, 30}, nil)
+
+	t.Run("per_repository_strategy", func(t *testing.T) {
+		ko := koanf.New(".")
+		ko.Load(confmap.Provider(map[string]interface{}{
+			"prediction.strategy": "constant",
+			"prediction.hours":    2,
+			"prediction.repositories": []interface{}{
+				map[string]interface{}{"name": "org/monorepo", "strategy": "percentile", "percentile": 50},
+				map[string]interface{}{"name": "org/Docs", "hours": 6},
+				map[string]interface{}{"name": "org/web", "strategy": "size", "base_hours": 1, "hours_per_100_lines": 2},
+			},
+		}, "."), nil)
+
+		p, err := NewPredictor(ko, history, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 20, p.EstimateLifeTime(Features{RepoId: 1, Repository: "org/monorepo"}))
+		assert.Equal(t, 6, p.EstimateLifeTime(Features{RepoId: 2, Repository: "org/docs"}))
+		assert.Equal(t, 5, p.EstimateLifeTime(Features{RepoId: 3, Repository: "org/web", LinesAdded: 200}))
+		assert.Equal(t, 2, p.EstimateLifeTime(Features{RepoId: 4, Repository: "org/other"}))
+	})
+
+	t.Run("defaults_to_model", func(t *testing.T) {
+		p, err := NewPredictor(koanf.New("."), history, nil)
+		assert.NoError(t, err)
+		assert.IsType(t, &EffortModel{}, p.(*RepositoryPredictor).Default)
+	})
+
+	t.Run("invalid_configuration", func(t *testing.T) {
+		testCases := []map[string]interface{}{
+			{"prediction.strategy": "unknown"},
+			{"prediction.strategy": "constant"},
+			{"prediction.strategy": "percentile", "prediction.percentile": 120},
+			{"prediction.repositories": []interface{}{map[string]interface{}{"strategy": "size"}}},
+		}
+		for _, tc := range testCases {
+			ko := koanf.New(".")
+			ko.Load(confmap.Provider(tc, "."), nil)
+			_, err := NewPredictor(ko, history, nil)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Equal(t, 5.5, percentile([]float64{10, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 50))
+	assert.Equal(t, 10.0, percentile([]float64{10, 1, 2}, 100))
+	assert.Equal(t, 4.0, percentile([]float64{4}, 90))
+}
@@ -0,0 +1,146 @@
+package prediction
+
+import (
+	"errors"
+	"math"
+)
+
+// ridgePenalty keeps the least squares fit stable when the features are collinear,
+// e.g. when every pull request of a repository has a single commit
+const ridgePenalty = 0.1
+
+// Sample is a merged pull request used to fit the effort estimation model
+type Sample struct {
+	Features      Features
+	LifeTimeHours float64
+}
+
+// TrainedModels provides the coefficients fitted for a repository by the train command
+type TrainedModels interface {
+	FindCoefficients(repoId int64) (*Coefficients, error)
+}
+
+// TrainedPredictor estimates the lifetime using the coefficients fitted for the repository of
+// the pull request. Repositories which have not been trained yet use the Fallback predictor.
+type TrainedPredictor struct {
+	Models   TrainedModels
+	Fallback LifetimePredictor
+}
+
+func (t *TrainedPredictor) EstimateLifeTime(f Features) int {
+	coefficients, err := t.Models.FindCoefficients(f.RepoId)
+	if err != nil || coefficients == nil {
+		return t.Fallback.EstimateLifeTime(f)
+	}
+	return Init(*coefficients).EstimateLifeTime(f)
+}
+
+// Fit fits the coefficients of the effort estimation model to the samples using ridge regularized
+// least squares on the log of the lifetime. At least minSamples samples are required.
+// Note: The protection of the base branch does not vary within a repository, its effect is
+// a part of the intercept.
+func Fit(samples []Sample, minSamples int) (*Coefficients, error) {
+	if len(samples) == 0 || len(samples) < minSamples {
+		return nil, errors.New("not enough samples to fit the model")
+	}
+
+	const columns = 7
+	xtx := make([][]float64, columns)
+	for i := range xtx {
+		xtx[i] = make([]float64, columns)
+	}
+	xty := make([]float64, columns)
+	maxHours := 1.0
+
+	for _, s := range samples {
+		row := featureRow(s.Features)
+		// Lifetimes shorter than half an hour are noise for the model
+		y := math.Log(math.Max(s.LifeTimeHours, 0.5))
+		for i := 0; i < columns; i++ {
+			for j := 0; j < columns; j++ {
+				xtx[i][j] += row[i] * row[j]
+			}
+			xty[i] += row[i] * y
+		}
+		maxHours = math.Max(maxHours, s.LifeTimeHours)
+	}
+
+	for i := 1; i < columns; i++ {
+		// The intercept is not penalized
+		xtx[i][i] += ridgePenalty
+	}
+
+	beta, err := solve(xtx, xty)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Coefficients{
+		Intercept:     beta[0],
+		LinesAdded:    beta[1],
+		LinesDeleted:  beta[2],
+		FilesChanged:  beta[3],
+		Commits:       beta[4],
+		Reviewers:     beta[5],
+		AuthorHistory: beta[6],
+		MinHours:      1,
+		MaxHours:      int(math.Ceil(maxHours)),
+	}, nil
+}
+
+// featureRow returns the feature vector in the same form as used by EffortModel.EstimateLifeTime
+func featureRow(f Features) []float64 {
+	authorHistory := 0.0
+	if len(f.AuthorMergeHours) > 0 {
+		authorHistory = math.Log1p(median(f.AuthorMergeHours))
+	}
+	return []float64{
+		1,
+		math.Log1p(float64(f.LinesAdded)),
+		math.Log1p(float64(f.LinesDeleted)),
+		math.Log1p(float64(f.FilesChanged)),
+		math.Log1p(float64(f.Commits)),
+		float64(f.Reviewers),
+		authorHistory,
+	}
+}
+
+// solve solves a.x = b using gaussian elimination with partial pivoting
+func solve(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = append(append(make([]float64, 0, n+1), a[i]...), b[i])
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, errors.New("the samples do not determine the model")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+
+	return x, nil
+}
@@ -0,0 +1,101 @@
+package prediction
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type TrainedModelsMock struct {
+	mock.Mock
+}
+
+func (m *TrainedModelsMock) FindCoefficients(repoId int64) (*Coefficients, error) {
+	args := m.Called(repoId)
+	return args.Get(0).(*Coefficients), args.Error(1)
+}
+
+func TestFit(t *testing.T) {
+	expected := Coefficients{
+		Intercept:     0.5,
+		LinesAdded:    0.3,
+		LinesDeleted:  0.1,
+		FilesChanged:  0.2,
+		Commits:       0.15,
+		Reviewers:     0.1,
+		AuthorHistory: 0.25,
+		MinHours:      1,
+		MaxHours:      1000,
+	}
+	model := Init(expected)
+
+	r := rand.New(rand.NewSource(1))
+	samples := make([]Sample, 0)
+	for i := 0; i < 500; i++ {
+		f := Features{
+			LinesAdded:       r.Intn(3000),
+			LinesDeleted:     r.Intn(1000),
+			FilesChanged:     r.Intn(60),
+			Commits:          r.Intn(30),
+			Reviewers:        r.Intn(4),
+			AuthorMergeHours: []float64{float64(r.Intn(200))},
+		}
+		row := featureRow(f)
+		score := expected.Intercept + expected.LinesAdded*row[1] + expected.LinesDeleted*row[2] +
+			expected.FilesChanged*row[3] + expected.Commits*row[4] + expected.Reviewers*row[5] +
+			expected.AuthorHistory*row[6]
+		samples = append(samples, Sample{Features: f, LifeTimeHours: math.Exp(score)})
+	}
+
+	coefficients, err := Fit(samples, 10)
+	assert.NoError(t, err)
+	assert.InDelta(t, expected.Intercept, coefficients.Intercept, 0.05)
+	assert.InDelta(t, expected.LinesAdded, coefficients.LinesAdded, 0.05)
+	assert.InDelta(t, expected.LinesDeleted, coefficients.LinesDeleted, 0.05)
+	assert.InDelta(t, expected.FilesChanged, coefficients.FilesChanged, 0.05)
+	assert.InDelta(t, expected.Commits, coefficients.Commits, 0.05)
+	assert.InDelta(t, expected.Reviewers, coefficients.Reviewers, 0.05)
+	assert.InDelta(t, expected.AuthorHistory, coefficients.AuthorHistory, 0.05)
+	assert.Equal(t, 1, coefficients.MinHours)
+
+	f := Features{LinesAdded: 100, FilesChanged: 3, Commits: 2, Reviewers: 1}
+	assert.InDelta(t, model.EstimateLifeTime(f), Init(*coefficients).EstimateLifeTime(f), 1)
+}
+
+func TestFitNotEnoughSamples(t *testing.T) {
+	_, err := Fit([]Sample{{LifeTimeHours: 2}}, 10)
+	assert.Error(t, err)
+
+	_, err = Fit(nil, 0)
+	assert.Error(t, err)
+}
+
+func TestFitIdenticalSamples(t *testing.T) {
+	// Every PR has the same features, only the intercept can be determined
+	samples := make([]Sample, 0)
+	for i := 0; i < 20; i++ {
+		samples = append(samples, Sample{
+			Features:      Features{LinesAdded: 10, FilesChanged: 1, Commits: 1},
+			LifeTimeHours: 7.5,
+		})
+	}
+	coefficients, err := Fit(samples, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, Init(*coefficients).EstimateLifeTime(Features{LinesAdded: 10, FilesChanged: 1, Commits: 1}))
+}
+
+func TestTrainedPredictor(t *testing.T) {
+	models := &TrainedModelsMock{}
+	models.On("FindCoefficients", int64(1)).Return(&Coefficients{Intercept: math.Log(9.5), MinHours: 1, MaxHours: 100}, nil)
+	models.On("FindCoefficients", int64(2)).Return((*Coefficients)(nil), errors.New("no documents in result"))
+
+	p := &TrainedPredictor{
+		Models:   models,
+		Fallback: &ConstantPredictor{Hours: 2},
+	}
+	assert.Equal(t, 10, p.EstimateLifeTime(Features{RepoId: 1}))
+	assert.Equal(t, 2, p.EstimateLifeTime(Features{RepoId: 2}))
+}
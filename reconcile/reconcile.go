@@ -0,0 +1,164 @@
+package reconcile
+
+import (
+	"fmt"
+	"github.com/google/go-github/v52/github"
+	prp "nudge/internal/database/pr"
+	"sort"
+	"strings"
+)
+
+// Kinds of drift between the PRs recorded by Nudge and the PRs on GitHub
+const (
+	DriftMissing = "missing"
+	DriftClosed  = "closed"
+	DriftChanged = "changed"
+)
+
+// Change is a PR, open on GitHub and recorded as open, whose recorded fields are stale
+type Change struct {
+	PR *github.PullRequest
+	// Fields are the fields of the PR model to update, by their bson name
+	Fields map[string]interface{}
+}
+
+// Drift is the difference between the open PRs recorded for a repository and its open PRs on GitHub
+type Drift struct {
+	// Missing are open on GitHub but not recorded as open
+	Missing []*github.PullRequest
+	// Closed are recorded as open but are no longer open on GitHub
+	Closed []prp.PRModel
+	// Changed are open on both, with stale draft, title, labels or review requests
+	Changed []Change
+}
+
+// Compute returns the drift of the PRs recorded as open (recorded) of the repository from its open PRs on GitHub.
+// The PRs of the bots are not expected to be recorded when ignoreBots is set.
+func Compute(repoId int64, recorded []prp.PRModel, open []*github.PullRequest, ignoreBots bool) Drift {
+	var drift Drift
+	recordedById := make(map[int64]prp.PRModel, len(recorded))
+	for _, prModel := range recorded {
+		recordedById[prModel.PRID] = prModel
+	}
+
+	openIds := make(map[int64]bool, len(open))
+	for _, pr := range open {
+		openIds[pr.GetID()] = true
+		prModel, found := recordedById[pr.GetID()]
+		if !found {
+			if ignoreBots && strings.EqualFold(pr.GetUser().GetType(), "bot") {
+				continue
+			}
+			drift.Missing = append(drift.Missing, pr)
+			continue
+		}
+		if fields := staleFields(prModel, *prp.CreateDataModelForPR(*pr, repoId, prModel.LifeTime)); len(fields) > 0 {
+			drift.Changed = append(drift.Changed, Change{PR: pr, Fields: fields})
+		}
+	}
+
+	for _, prModel := range recorded {
+		if !openIds[prModel.PRID] {
+			drift.Closed = append(drift.Closed, prModel)
+		}
+	}
+	return drift
+}
+
+// staleFields returns the fields of the recorded PR which differ from the PR on GitHub (actual)
+func staleFields(recorded, actual prp.PRModel) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if boolOf(recorded.Draft) != boolOf(actual.Draft) {
+		fields["draft"] = boolOf(actual.Draft)
+	}
+	if stringOf(recorded.Title) != stringOf(actual.Title) {
+		fields["title"] = stringOf(actual.Title)
+	}
+	if !sameSet(recorded.Labels, actual.Labels) {
+		fields["labels"] = listOf(actual.Labels)
+	}
+	if !sameSet(recorded.RequestedReviewers, actual.RequestedReviewers) {
+		fields["requested_reviewers"] = listOf(actual.RequestedReviewers)
+	}
+	if !sameSet(recorded.RequestedTeams, actual.RequestedTeams) {
+		fields["requested_teams"] = listOf(actual.RequestedTeams)
+	}
+	return fields
+}
+
+// Empty returns true if the recorded PRs are in sync with GitHub
+func (d Drift) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Closed) == 0 && len(d.Changed) == 0
+}
+
+// String reports the drift, e.g. "1 missing (#12), 1 closed (#7), 2 changed (#3 draft, #5 labels requested_reviewers)"
+func (d Drift) String() string {
+	parts := make([]string, 0, 3)
+	if len(d.Missing) > 0 {
+		numbers := make([]string, len(d.Missing))
+		for i, pr := range d.Missing {
+			numbers[i] = fmt.Sprintf("#%d", pr.GetNumber())
+		}
+		parts = append(parts, fmt.Sprintf("%d %s (%s)", len(d.Missing), DriftMissing, strings.Join(numbers, ", ")))
+	}
+	if len(d.Closed) > 0 {
+		numbers := make([]string, len(d.Closed))
+		for i, prModel := range d.Closed {
+			numbers[i] = fmt.Sprintf("#%d", prModel.Number)
+		}
+		parts = append(parts, fmt.Sprintf("%d %s (%s)", len(d.Closed), DriftClosed, strings.Join(numbers, ", ")))
+	}
+	if len(d.Changed) > 0 {
+		changes := make([]string, len(d.Changed))
+		for i, change := range d.Changed {
+			fields := make([]string, 0, len(change.Fields))
+			for field := range change.Fields {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			changes[i] = fmt.Sprintf("#%d %s", change.PR.GetNumber(), strings.Join(fields, " "))
+		}
+		parts = append(parts, fmt.Sprintf("%d %s (%s)", len(d.Changed), DriftChanged, strings.Join(changes, ", ")))
+	}
+	if len(parts) == 0 {
+		return "no drift"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func boolOf(b *bool) bool {
+	return b != nil && *b
+}
+
+func stringOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func listOf(l *[]string) []string {
+	if l == nil {
+		return []string{}
+	}
+	return *l
+}
+
+// sameSet returns true if both lists hold the same values, in any order (case-insensitive)
+func sameSet(a, b *[]string) bool {
+	la, lb := listOf(a), listOf(b)
+	if len(la) != len(lb) {
+		return false
+	}
+	counts := make(map[string]int, len(la))
+	for _, v := range la {
+		counts[strings.ToLower(v)]++
+	}
+	for _, v := range lb {
+		counts[strings.ToLower(v)]--
+		if counts[strings.ToLower(v)] < 0 {
+			return false
+		}
+	}
+	return true
+}
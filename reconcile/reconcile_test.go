@@ -0,0 +1,69 @@
+package reconcile
+
+import (
+	"github.com/google/go-github/v52/github"
+	"github.com/stretchr/testify/assert"
+	prp "nudge/internal/database/pr"
+	"testing"
+	"time"
+)
+
+func openPR(id int64, number int, draft bool, reviewers ...string) *github.PullRequest {
+	requested := make([]*github.User, len(reviewers))
+	for i, reviewer := range reviewers {
+		requested[i] = &github.User{Login: github.String(reviewer)}
+	}
+	now := github.Timestamp{Time: time.Unix(1700000000, 0)}
+	return &github.PullRequest{
+		ID:                 github.Int64(id),
+		Number:             github.Int(number),
+		State:              github.String("open"),
+		Title:              github.String("Add feature"),
+		Draft:              github.Bool(draft),
+		User:               &github.User{Login: github.String("alice"), Type: github.String("User")},
+		RequestedReviewers: requested,
+		CreatedAt:          &now,
+		UpdatedAt:          &now,
+	}
+}
+
+func TestCompute(t *testing.T) {
+	inSync := openPR(1, 1, false, "bob")
+	convertedToDraft := openPR(2, 2, true, "bob", "carol")
+	missing := openPR(3, 3, false)
+	bot := openPR(4, 4, false)
+	bot.User = &github.User{Login: github.String("renovate[bot]"), Type: github.String("Bot")}
+
+	recorded := []prp.PRModel{
+		*prp.CreateDataModelForPR(*inSync, 1, 10),
+		*prp.CreateDataModelForPR(*openPR(2, 2, false, "carol", "bob"), 1, 10),
+		// Merged while a delivery was lost
+		{PRID: 5, Number: 5, RepoId: 1, Status: "open"},
+	}
+
+	drift := Compute(1, recorded, []*github.PullRequest{inSync, convertedToDraft, missing, bot}, true)
+	assert.Equal(t, []*github.PullRequest{missing}, drift.Missing)
+	assert.Len(t, drift.Closed, 1)
+	assert.Equal(t, int64(5), drift.Closed[0].PRID)
+	assert.Len(t, drift.Changed, 1)
+	assert.Equal(t, map[string]interface{}{"draft": true}, drift.Changed[0].Fields)
+	assert.Equal(t, "1 missing (#3), 1 closed (#5), 1 changed (#2 draft)", drift.String())
+
+	drift = Compute(1, recorded, []*github.PullRequest{inSync, convertedToDraft, missing, bot}, false)
+	assert.Len(t, drift.Missing, 2)
+}
+
+func TestComputeReviewRequests(t *testing.T) {
+	recorded := []prp.PRModel{*prp.CreateDataModelForPR(*openPR(1, 1, false, "bob"), 1, 10)}
+
+	drift := Compute(1, recorded, []*github.PullRequest{openPR(1, 1, false, "carol")}, false)
+	assert.Len(t, drift.Changed, 1)
+	assert.Equal(t, []string{"carol"}, drift.Changed[0].Fields["requested_reviewers"])
+
+	drift = Compute(1, recorded, []*github.PullRequest{openPR(1, 1, false)}, false)
+	assert.Equal(t, []string{}, drift.Changed[0].Fields["requested_reviewers"])
+
+	drift = Compute(1, recorded, []*github.PullRequest{openPR(1, 1, false, "Bob")}, false)
+	assert.True(t, drift.Empty())
+	assert.Equal(t, "no drift", drift.String())
+}
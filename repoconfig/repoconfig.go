@@ -0,0 +1,238 @@
+package repoconfig
+
+import (
+	"fmt"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"nudge/actor"
+	"sort"
+	"strings"
+)
+
+// Path is the location of the configuration file in the repository. It is read from the default branch.
+const Path = ".github/nudge.yml"
+
+// ValidationError is a setting of the configuration file which is invalid
+type ValidationError struct {
+	// Key is the setting (e.g. interval_to_wait.time). Empty if the file itself is invalid.
+	Key     string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if len(e.Key) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// validator returns the problem with the value of the setting, or an empty string if it is valid
+type validator func(value interface{}) string
+
+// settings are the bot.* settings which can be overridden by the configuration file of a repository
+var settings = map[string]validator{
+	"interval_to_wait.unit":                               oneOf("h", "m"),
+	"interval_to_wait.time":                               positiveNumber,
+	"skip_days":                                           weekdays,
+	"follow_up_threshold_comments":                        nonNegativeInteger,
+	"ignore_bot_prs":                                      boolean,
+	"ci.pending_timeout":                                  nonNegativeNumber,
+	"activity.threshold":                                  nonNegativeNumber,
+	"activity.signal_weights.commit":                      nonNegativeNumber,
+	"activity.signal_weights.review":                      nonNegativeNumber,
+	"activity.signal_weights.state_change":                nonNegativeNumber,
+	"activity.signal_weights.thread_status":               nonNegativeNumber,
+	"activity.signal_weights.comment":                     nonNegativeNumber,
+	"activity.signal_weights.acknowledgement":             nonNegativeNumber,
+	"activity.actor_weights.author":                       nonNegativeNumber,
+	"activity.actor_weights.reviewer":                     nonNegativeNumber,
+	"activity.actor_weights.other":                        nonNegativeNumber,
+	"activity.actor_weights.bot":                          nonNegativeNumber,
+	"exclude.labels":                                      stringList,
+	"exclude.authors":                                     stringList,
+	"exclude.title_prefixes":                              stringList,
+	"channels.github":                                     boolean,
+	"channels.slack":                                      boolean,
+	"messages." + string(actor.ReasonAwaitingFirstReview): nonEmptyString,
+	"messages." + string(actor.ReasonChangesRequested):    nonEmptyString,
+	"messages." + string(actor.ReasonUnresolvedThreads):   nonEmptyString,
+	"messages." + string(actor.ReasonApprovedNotMerged):   nonEmptyString,
+	"messages." + string(actor.ReasonCIFailing):           nonEmptyString,
+	"messages." + string(actor.ReasonMergeConflict):       nonEmptyString,
+	"messages." + string(actor.ReasonBehindBase):          nonEmptyString,
+	"messages." + string(actor.ReasonNotEnoughApprovals):  nonEmptyString,
+}
+
+// globalSettings are the bot.* settings which apply to every repository, and cannot be overridden
+var globalSettings = []string{"next_check_in", "default_timezone", "default_business_hours"}
+
+// Parse parses and validates the content of the configuration file of the repository. The settings
+// of the file are the bot.* settings, without the bot prefix. Returns the validation errors, sorted by
+// the setting, if the file is invalid.
+func Parse(content string) (*koanf.Koanf, []ValidationError) {
+	values, err := yaml.Parser().Unmarshal([]byte(content))
+	if err != nil {
+		return nil, []ValidationError{{Message: fmt.Sprintf("invalid YAML - %v", err)}}
+	}
+	k := koanf.New(".")
+	if err = k.Load(confmap.Provider(values, ""), nil); err != nil {
+		return nil, []ValidationError{{Message: err.Error()}}
+	}
+
+	errs := make([]ValidationError, 0)
+	all := k.All()
+	keys := k.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := all[key]
+		if group, ok := value.(map[string]interface{}); ok && len(group) == 0 {
+			// Empty groups (e.g. exclude: {}) override nothing
+			continue
+		}
+		if isGlobalSetting(key) {
+			errs = append(errs, ValidationError{Key: key, Message: "applies to every repository and cannot be overridden"})
+			continue
+		}
+		validate, known := settings[key]
+		if !known {
+			errs = append(errs, ValidationError{Key: key, Message: "unknown setting"})
+			continue
+		}
+		if value == nil {
+			errs = append(errs, ValidationError{Key: key, Message: "missing value"})
+			continue
+		}
+		if problem := validate(value); len(problem) > 0 {
+			errs = append(errs, ValidationError{Key: key, Message: problem})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return k, nil
+}
+
+// ForRepository returns the configuration for the repository, which is the global configuration with the
+// bot.* settings overridden by the configuration file of the repository (content). The global configuration
+// is returned as is if the repository has no configuration file, or an invalid one.
+func ForRepository(global *koanf.Koanf, content *string) *koanf.Koanf {
+	if content == nil || len(strings.TrimSpace(*content)) == 0 {
+		return global
+	}
+	repoConfig, errs := Parse(*content)
+	if len(errs) > 0 {
+		return global
+	}
+	conf := global.Copy()
+	if err := conf.MergeAt(repoConfig, "bot"); err != nil {
+		return global
+	}
+	return conf
+}
+
+// ChannelEnabled returns true if the nudges are posted on the channel (bot.channels.<channel>).
+// The channels are enabled unless disabled by the configuration.
+func ChannelEnabled(ko *koanf.Koanf, channel string) bool {
+	key := "bot.channels." + channel
+	return !ko.Exists(key) || ko.Bool(key)
+}
+
+func isGlobalSetting(key string) bool {
+	for _, setting := range globalSettings {
+		if key == setting || strings.HasPrefix(key, setting+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func positiveNumber(value interface{}) string {
+	if n, ok := number(value); !ok || n <= 0 {
+		return "must be a number greater than 0"
+	}
+	return ""
+}
+
+func nonNegativeNumber(value interface{}) string {
+	if n, ok := number(value); !ok || n < 0 {
+		return "must be a number greater than or equal to 0"
+	}
+	return ""
+}
+
+func nonNegativeInteger(value interface{}) string {
+	if n, ok := number(value); !ok || n < 0 || n != float64(int64(n)) {
+		return "must be an integer greater than or equal to 0"
+	}
+	return ""
+}
+
+func boolean(value interface{}) string {
+	if _, ok := value.(bool); !ok {
+		return "must be true or false"
+	}
+	return ""
+}
+
+func nonEmptyString(value interface{}) string {
+	if s, ok := value.(string); !ok || len(strings.TrimSpace(s)) == 0 {
+		return "must be a non-empty string"
+	}
+	return ""
+}
+
+func oneOf(allowed ...string) validator {
+	return func(value interface{}) string {
+		if s, ok := value.(string); ok {
+			for _, a := range allowed {
+				if s == a {
+					return ""
+				}
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func stringList(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return "must be a list of strings"
+	}
+	for _, item := range list {
+		if s, isString := item.(string); !isString || len(strings.TrimSpace(s)) == 0 {
+			return "must be a list of strings"
+		}
+	}
+	return ""
+}
+
+// weekdays validates the days of the week, from 0 (sunday) to 6 (saturday)
+func weekdays(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return "must be a list of days from 0 (sunday) to 6 (saturday)"
+	}
+	for _, item := range list {
+		if n, isNumber := number(item); !isNumber || n < 0 || n > 6 || n != float64(int64(n)) {
+			return "must be a list of days from 0 (sunday) to 6 (saturday)"
+		}
+	}
+	return ""
+}
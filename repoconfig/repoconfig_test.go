@@ -0,0 +1,124 @@
+package repoconfig
+
+import (
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const validConfig = `
+interval_to_wait:
+  time: 4
+skip_days: [0]
+follow_up_threshold_comments: 2
+activity:
+  signal_weights:
+    comment: 0.25
+exclude:
+  labels: [wip, dependencies]
+  authors: ["renovate[bot]"]
+channels:
+  slack: false
+messages:
+  awaiting_first_review: is waiting for a review. Reach out on #reviews if you need help.
+`
+
+func TestParse(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		k, errs := Parse(validConfig)
+		assert.Empty(t, errs)
+		assert.Equal(t, 4.0, k.Float64("interval_to_wait.time"))
+		assert.Equal(t, []string{"wip", "dependencies"}, k.Strings("exclude.labels"))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		k, errs := Parse("")
+		assert.Empty(t, errs)
+		assert.Empty(t, k.Keys())
+	})
+
+	t.Run("invalid_yaml", func(t *testing.T) {
+		_, errs := Parse("skip_days: [0\n")
+		assert.Len(t, errs, 1)
+		assert.Empty(t, errs[0].Key)
+	})
+
+	t.Run("not_a_map", func(t *testing.T) {
+		_, errs := Parse("- 1\n- 2\n")
+		assert.Len(t, errs, 1)
+	})
+
+	t.Run("invalid_settings", func(t *testing.T) {
+		_, errs := Parse(`
+interval_to_wait:
+  unit: d
+  time: 0
+next_check_in:
+  time: 2
+skip_days: [7]
+follow_up_threshold_comments: 1.5
+ignore_bot_prs: "yes"
+exclude:
+  labels: wip
+channels:
+  email: true
+messages:
+  ci_failing: ""
+`)
+		assert.Equal(t, []ValidationError{
+			{Key: "channels.email", Message: "unknown setting"},
+			{Key: "exclude.labels", Message: "must be a list of strings"},
+			{Key: "follow_up_threshold_comments", Message: "must be an integer greater than or equal to 0"},
+			{Key: "ignore_bot_prs", Message: "must be true or false"},
+			{Key: "interval_to_wait.time", Message: "must be a number greater than 0"},
+			{Key: "interval_to_wait.unit", Message: "must be one of h, m"},
+			{Key: "messages.ci_failing", Message: "must be a non-empty string"},
+			{Key: "next_check_in.time", Message: "applies to every repository and cannot be overridden"},
+			{Key: "skip_days", Message: "must be a list of days from 0 (sunday) to 6 (saturday)"},
+		}, errs)
+		assert.Equal(t, "skip_days: must be a list of days from 0 (sunday) to 6 (saturday)", errs[8].Error())
+	})
+}
+
+func TestForRepository(t *testing.T) {
+	global := koanf.New(".")
+	global.Load(confmap.Provider(map[string]interface{}{
+		"bot.interval_to_wait.unit":        "h",
+		"bot.interval_to_wait.time":        1,
+		"bot.skip_days":                    []interface{}{0, 6},
+		"bot.follow_up_threshold_comments": 7,
+		"github.app_id":                    "1234",
+	}, "."), nil)
+
+	t.Run("overridden", func(t *testing.T) {
+		content := validConfig
+		conf := ForRepository(global, &content)
+		assert.Equal(t, "h", conf.String("bot.interval_to_wait.unit"))
+		assert.Equal(t, 4.0, conf.Float64("bot.interval_to_wait.time"))
+		assert.Equal(t, []int{0}, conf.Ints("bot.skip_days"))
+		assert.Equal(t, 2, conf.Int("bot.follow_up_threshold_comments"))
+		assert.Equal(t, "1234", conf.String("github.app_id"))
+		// The global configuration is left untouched
+		assert.Equal(t, []int{0, 6}, global.Ints("bot.skip_days"))
+		assert.Equal(t, 7, global.Int("bot.follow_up_threshold_comments"))
+	})
+
+	t.Run("without_config", func(t *testing.T) {
+		assert.Same(t, global, ForRepository(global, nil))
+		empty := ""
+		assert.Same(t, global, ForRepository(global, &empty))
+	})
+
+	t.Run("invalid_config", func(t *testing.T) {
+		invalid := "follow_up_threshold_comments: -1"
+		assert.Same(t, global, ForRepository(global, &invalid))
+	})
+}
+
+func TestChannelEnabled(t *testing.T) {
+	content := validConfig
+	conf := ForRepository(koanf.New("."), &content)
+	assert.True(t, ChannelEnabled(conf, "github"))
+	assert.False(t, ChannelEnabled(conf, "slack"))
+}